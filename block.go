@@ -0,0 +1,218 @@
+package vclock
+
+import (
+	"errors"
+)
+
+var errBadBlock = errors.New("bad vclock block")
+
+// EncodeBlock returns the serialized representation of many clocks at
+// once. The ids of all clocks are stored a single time in a shared
+// dictionary, and the ticks and update times of consecutive entries within
+// each clock are delta-coded. The returned data may be loaded by OpenBlock.
+//
+// The format of the block is:
+//
+//	[ header byte | D | [ id len | id ] * D | N | [ clock size ] * N | clock * N ]
+//
+// and the format of each clock within it is:
+//
+//	[ header byte | watermark | E | [ id index | ticks delta | time delta ] * E ]
+//
+// where the time delta is present only if the clock header has the 0x1 bit
+// set, the pruning watermark only if it has the 0x2 bit set, and deltas
+// are zig-zag encoded so that decreasing values are also packed in short
+// space.
+func EncodeBlock(clocks []*VClock) []byte {
+	var ids []string
+	index := make(map[string]uint64)
+	for _, vc := range clocks {
+		for i := range vc.items {
+			if _, found := index[vc.items[i].id]; !found {
+				index[vc.items[i].id] = uint64(len(ids))
+				ids = append(ids, vc.items[i].id)
+			}
+		}
+	}
+
+	sizes := make([]int, len(clocks))
+	size := 1 + packedIntSize(uint64(len(ids))) + packedIntSize(uint64(len(clocks)))
+	for _, id := range ids {
+		size += packedIntSize(uint64(len(id))) + len(id)
+	}
+	for i, vc := range clocks {
+		sizes[i] = vc.computeBlockSize(index)
+		size += packedIntSize(uint64(sizes[i])) + sizes[i]
+	}
+
+	result := make([]byte, size)
+	pos := 1 // result[0] is header byte.
+	pos += packInt(uint64(len(ids)), result[pos:])
+	for _, id := range ids {
+		pos += packInt(uint64(len(id)), result[pos:])
+		pos += copy(result[pos:], id)
+	}
+	pos += packInt(uint64(len(clocks)), result[pos:])
+	for _, size := range sizes {
+		pos += packInt(uint64(size), result[pos:])
+	}
+	for _, vc := range clocks {
+		if vc.hasUpdateTime {
+			result[pos] |= 0x1
+		}
+		if vc.pruned {
+			result[pos] |= 0x2
+			pos += packInt(vc.watermark, result[pos+1:])
+		}
+		pos++
+		pos += packInt(uint64(len(vc.items)), result[pos:])
+		var ticks, lastUpdate uint64
+		for i := range vc.items {
+			item := &vc.items[i]
+			pos += packInt(index[item.id], result[pos:])
+			pos += packInt(zigzag(item.ticks-ticks), result[pos:])
+			if vc.hasUpdateTime {
+				pos += packInt(zigzag(item.lastUpdate-lastUpdate), result[pos:])
+			}
+			ticks, lastUpdate = item.ticks, item.lastUpdate
+		}
+	}
+	return result
+}
+
+func (vc *VClock) computeBlockSize(index map[string]uint64) int {
+	size := 1 + prunedSize(vc.pruned, vc.watermark) + packedIntSize(uint64(len(vc.items)))
+	var ticks, lastUpdate uint64
+	for i := range vc.items {
+		item := &vc.items[i]
+		size += packedIntSize(index[item.id])
+		size += packedIntSize(zigzag(item.ticks - ticks))
+		if vc.hasUpdateTime {
+			size += packedIntSize(zigzag(item.lastUpdate - lastUpdate))
+		}
+		ticks, lastUpdate = item.ticks, item.lastUpdate
+	}
+	return size
+}
+
+// zigzag maps the difference between two values, taken modulo 2^64,
+// onto a value that is small when the difference is small in either
+// direction.
+func zigzag(delta uint64) uint64 {
+	return delta<<1 ^ uint64(int64(delta)>>63)
+}
+
+func unzigzag(value uint64) uint64 {
+	return value>>1 ^ -(value & 1)
+}
+
+// Block provides random access to the clocks within a block generated
+// by EncodeBlock.
+type Block struct {
+	ids    []string
+	clocks [][]byte
+}
+
+// OpenBlock returns the block represented by the provided data, which
+// must have been generated by EncodeBlock. The dictionary and the position
+// of each clock are loaded, but clocks are only decoded by Block.Clock.
+// The block keeps references to data, which must not be modified.
+func OpenBlock(data []byte) (*Block, error) {
+	if len(data) == 0 || data[0] != 0 {
+		return nil, errBadBlock
+	}
+	data = data[1:]
+	nids, size, ok := unpackInt(data)
+	if !ok || nids > uint64(len(data)) {
+		return nil, errBadBlock
+	}
+	data = data[size:]
+	b := &Block{ids: make([]string, nids)}
+	for i := range b.ids {
+		var id string
+		if id, data, ok = unpackID(data); !ok {
+			return nil, errBadBlock
+		}
+		b.ids[i] = id
+	}
+	nclocks, size, ok := unpackInt(data)
+	if !ok || nclocks > uint64(len(data)) {
+		return nil, errBadBlock
+	}
+	data = data[size:]
+	sizes := make([]uint64, nclocks)
+	for i := range sizes {
+		if sizes[i], size, ok = unpackInt(data); !ok {
+			return nil, errBadBlock
+		}
+		data = data[size:]
+	}
+	b.clocks = make([][]byte, nclocks)
+	for i, size := range sizes {
+		if size > uint64(len(data)) {
+			return nil, errBadBlock
+		}
+		b.clocks[i], data = data[:size], data[size:]
+	}
+	if len(data) != 0 {
+		return nil, errBadBlock
+	}
+	return b, nil
+}
+
+// Len returns the number of clocks in b.
+func (b *Block) Len() int {
+	return len(b.clocks)
+}
+
+// Clock decodes and returns the i-th clock in b, with 0 <= i < b.Len().
+func (b *Block) Clock(i int) (*VClock, error) {
+	data := b.clocks[i]
+	if len(data) == 0 || data[0]&^0x03 != 0 {
+		return nil, errBadBlock
+	}
+	vc := New()
+	vc.hasUpdateTime = data[0]&0x01 != 0
+	pruned := data[0]&0x02 != 0
+	data = data[1:]
+	if pruned {
+		watermark, size, ok := unpackInt(data)
+		if !ok {
+			return nil, errBadBlock
+		}
+		data = data[size:]
+		vc.setPruned(watermark)
+	}
+	n, size, ok := unpackInt(data)
+	if !ok || n > uint64(len(data)) {
+		return nil, errBadBlock
+	}
+	data = data[size:]
+	vc.items = make([]itemType, 0, n)
+	var ticks, lastUpdate uint64
+	for ; n > 0; n-- {
+		idIndex, size, ok := unpackInt(data)
+		if !ok || idIndex >= uint64(len(b.ids)) {
+			return nil, errBadBlock
+		}
+		data = data[size:]
+		delta, size, ok := unpackInt(data)
+		if !ok {
+			return nil, errBadBlock
+		}
+		data = data[size:]
+		ticks += unzigzag(delta)
+		if vc.hasUpdateTime {
+			if delta, size, ok = unpackInt(data); !ok {
+				return nil, errBadBlock
+			}
+			data = data[size:]
+			lastUpdate += unzigzag(delta)
+		}
+		vc.updateItem(b.ids[idIndex], ticks, lastUpdate)
+	}
+	if len(data) != 0 {
+		return nil, errBadBlock
+	}
+	return vc, nil
+}
@@ -0,0 +1,93 @@
+package vclock_test
+
+import (
+	"fmt"
+	"github.com/jbondeson/vclock"
+	. "launchpad.net/gocheck"
+)
+
+func (S) TestBlockSimple(c *C) {
+	vc1 := vclock.New()
+	vc1.Update("idA", 0)
+	vc1.Update("idB", 0)
+	vc1.Update("idB", 0)
+	vc2 := vclock.New()
+	vc2.Update("idB", 0)
+
+	data := vclock.EncodeBlock([]*vclock.VClock{vc1, vc2})
+	c.Assert(data, DeepEquals, []byte{
+		0,                                     // Header.
+		2, 3, 'i', 'd', 'A', 3, 'i', 'd', 'B', // Dictionary.
+		2, 6, 4, // Clock sizes.
+		0, 2, 0, 2, 1, 2, // idA ticks +1, idB ticks +1.
+		0, 1, 1, 2, // idB ticks +1.
+	})
+}
+
+func (S) TestBlockRoundTrip(c *C) {
+	var clocks []*vclock.VClock
+	for i := 0; i != 50; i++ {
+		vc := vclock.New()
+		for j := 0; j <= i%7; j++ {
+			for k := 0; k <= (i+j)%3; k++ {
+				vc.Update(fmt.Sprintf("node-%d", (i+j)%11), uint64(1000000+i*10-j))
+			}
+		}
+		clocks = append(clocks, vc)
+	}
+	clocks = append(clocks, vclock.New())
+
+	data := vclock.EncodeBlock(clocks)
+	total := 0
+	for _, vc := range clocks {
+		total += len(vc.Bytes())
+	}
+	c.Assert(len(data) < total/2, Equals, true, Commentf("block %d, separate %d", len(data), total))
+
+	block, err := vclock.OpenBlock(data)
+	c.Assert(err, IsNil)
+	c.Assert(block.Len(), Equals, len(clocks))
+	// Clocks may be decoded in any order.
+	for i := len(clocks) - 1; i >= 0; i-- {
+		vc, err := block.Clock(i)
+		c.Assert(err, IsNil)
+		c.Assert(vc.Bytes(), DeepEquals, clocks[i].Bytes(), Commentf("clock %d", i))
+	}
+}
+
+func (S) TestBlockEmpty(c *C) {
+	data := vclock.EncodeBlock(nil)
+	c.Assert(data, DeepEquals, []byte{0, 0, 0})
+	block, err := vclock.OpenBlock(data)
+	c.Assert(err, IsNil)
+	c.Assert(block.Len(), Equals, 0)
+}
+
+func (S) TestOpenBlockWithBadData(c *C) {
+	for _, data := range [][]byte{
+		{},
+		{1, 0, 0},
+		{0, 1, 3, 'i', 'd'},
+		{0, 0, 1, 5, 0, 0},
+		{0, 0, 1, 2, 0, 0, 0},
+	} {
+		block, err := vclock.OpenBlock(data)
+		c.Assert(err, ErrorMatches, "bad vclock block", Commentf("%v", data))
+		c.Assert(block, IsNil)
+	}
+}
+
+func (S) TestBlockClockWithBadData(c *C) {
+	for _, data := range [][]byte{
+		{0, 0, 1, 2, 2, 0},
+		{0, 0, 1, 3, 0, 1, 0},
+		{0, 1, 1, 'X', 1, 3, 0, 1, 0},
+		{0, 1, 1, 'X', 1, 5, 0, 1, 0, 2, 9},
+	} {
+		block, err := vclock.OpenBlock(data)
+		c.Assert(err, IsNil, Commentf("%v", data))
+		vc, err := block.Clock(0)
+		c.Assert(err, ErrorMatches, "bad vclock block", Commentf("%v", data))
+		c.Assert(vc, IsNil)
+	}
+}
@@ -0,0 +1,70 @@
+package vclock
+
+// BoundedClock wraps a vector clock so that it is truncated by a policy
+// after every Update and Merge, keeping its size under control without
+// callers having to remember to truncate it. Truncation is skipped when
+// the policies in this package tell it would drop nothing, so clocks
+// within their limits are not reordered.
+//
+// Like VClock, a BoundedClock is not safe for concurrent use.
+type BoundedClock struct {
+	vc     *VClock
+	policy TruncationPolicy
+	stats  BoundedStats
+}
+
+// BoundedStats holds counters of the truncations performed by a
+// BoundedClock.
+type BoundedStats struct {
+	// Prunes is the number of times truncation dropped entries.
+	Prunes uint64
+	// Dropped is the total number of entries dropped.
+	Dropped uint64
+}
+
+// NewBounded returns a BoundedClock wrapping vc, which is truncated
+// according to policy right away. Changes made to vc other than through
+// the returned BoundedClock are not checked against the policy.
+func NewBounded(vc *VClock, policy TruncationPolicy) *BoundedClock {
+	b := &BoundedClock{vc: vc, policy: policy}
+	b.truncate()
+	return b
+}
+
+// Clock returns the vector clock wrapped by b.
+func (b *BoundedClock) Clock() *VClock {
+	return b.vc
+}
+
+// Stats returns the truncation counters of b.
+func (b *BoundedClock) Stats() BoundedStats {
+	return b.stats
+}
+
+// Update increments id's clock ticks as VClock.Update does, and then
+// truncates the clock.
+func (b *BoundedClock) Update(id string, when uint64) {
+	b.vc.Update(id, when)
+	b.truncate()
+}
+
+// Merge merges other into the clock as VClock.Merge does, and then
+// truncates it.
+func (b *BoundedClock) Merge(other *VClock) {
+	b.vc.Merge(other)
+	b.truncate()
+}
+
+func (b *BoundedClock) truncate() {
+	// Most updates leave the clock within the limits, so check for that
+	// before going through the trouble of sorting the items.
+	if !mayDrop(b.policy, b.vc) {
+		return
+	}
+	before := len(b.vc.items)
+	b.vc.TruncateInPlace(b.policy)
+	if dropped := before - len(b.vc.items); dropped > 0 {
+		b.stats.Prunes++
+		b.stats.Dropped += uint64(dropped)
+	}
+}
@@ -0,0 +1,91 @@
+package vclock_test
+
+import (
+	"github.com/jbondeson/vclock"
+	. "launchpad.net/gocheck"
+	"math/rand"
+)
+
+func (S) TestBoundedUpdate(c *C) {
+	b := vclock.NewBounded(vclock.New(), &vclock.Truncation{CutAboveN: 2})
+	b.Update("idA", 1)
+	b.Update("idB", 2)
+	c.Assert(b.Stats(), Equals, vclock.BoundedStats{})
+	b.Update("idC", 3)
+	b.Update("idB", 4)
+	c.Assert(b.Clock().Entries(), DeepEquals, []vclock.Entry{
+		{ID: "idC", Ticks: 1, LastUpdate: 3},
+		{ID: "idB", Ticks: 2, LastUpdate: 4},
+	})
+	c.Assert(b.Stats(), Equals, vclock.BoundedStats{Prunes: 1, Dropped: 1})
+}
+
+func (S) TestBoundedMerge(c *C) {
+	other := newTestClock([]truncItem{{"idC", 1, 3}, {"idD", 2, 4}, {"idE", 1, 1}})
+	b := vclock.NewBounded(newTestClock([]truncItem{{"idA", 1, 5}, {"idB", 1, 2}}), vclock.Pin(vclock.LRU{N: 2}, "idB"))
+	c.Assert(b.Clock().Len(), Equals, 2)
+	b.Merge(other)
+	c.Assert(b.Clock().Entries(), DeepEquals, []vclock.Entry{
+		{ID: "idA", Ticks: 1, LastUpdate: 5},
+		{ID: "idD", Ticks: 2, LastUpdate: 4},
+		{ID: "idB", Ticks: 1, LastUpdate: 2},
+	})
+	c.Assert(b.Stats(), Equals, vclock.BoundedStats{Prunes: 1, Dropped: 2})
+}
+
+func (S) TestBoundedTruncatesWrapped(c *C) {
+	vc := newTestClock([]truncItem{{"idA", 1, 1}, {"idB", 1, 2}, {"idC", 1, 3}})
+	b := vclock.NewBounded(vc, vclock.LRU{N: 1})
+	c.Assert(b.Clock(), Equals, vc)
+	c.Assert(vc.Entries(), DeepEquals, []vclock.Entry{{ID: "idC", Ticks: 1, LastUpdate: 3}})
+	c.Assert(b.Stats(), Equals, vclock.BoundedStats{Prunes: 1, Dropped: 2})
+}
+
+func (S) TestBoundedWithinLimits(c *C) {
+	policies := []vclock.TruncationPolicy{
+		vclock.LRU{N: 3},
+		vclock.MaxAge{Now: 5, Age: 4},
+		vclock.Pin(vclock.And(vclock.LRU{N: 3}, &vclock.Truncation{MaxBytes: 100}), "idA"),
+		vclock.Or(vclock.LRU{N: 1}, vclock.LRU{}),
+	}
+	for _, policy := range policies {
+		b := vclock.NewBounded(vclock.New(), policy)
+		b.Update("idA", 1)
+		b.Update("idB", 3)
+		b.Update("idA", 2)
+		b.Update("idC", 2)
+		// Clocks that are not pruned are left in the order of updates.
+		c.Assert(b.Clock().Entries(), DeepEquals, []vclock.Entry{
+			{ID: "idA", Ticks: 2, LastUpdate: 2},
+			{ID: "idB", Ticks: 1, LastUpdate: 3},
+			{ID: "idC", Ticks: 1, LastUpdate: 2},
+		}, Commentf("%#v", policy))
+		c.Assert(b.Stats(), Equals, vclock.BoundedStats{})
+	}
+}
+
+func (S) TestBoundedMatchesTruncate(c *C) {
+	rnd := rand.New(rand.NewSource(42))
+	for n := 0; n != 500; n++ {
+		vc := randomTestClock(rnd, 5)
+		t := &vclock.Truncation{
+			KeepMinN:  rnd.Intn(5),
+			CutAboveN: rnd.Intn(12),
+			CutBefore: uint64(rnd.Intn(30)),
+			MaxBytes:  rnd.Intn(3) * rnd.Intn(150),
+		}
+		lru := vclock.LRU{N: rnd.Intn(12)}
+		age := vclock.MaxAge{Now: uint64(rnd.Intn(30)), Age: uint64(rnd.Intn(20))}
+		policies := []vclock.TruncationPolicy{
+			vclock.Pin(t, "node-1"),
+			vclock.Pin(vclock.And(lru, t), "node-2"),
+			vclock.Or(lru, age),
+			vclock.And(age, &recordPolicy{}),
+		}
+		for _, policy := range policies {
+			b := vclock.NewBounded(vc.Copy(), policy)
+			cmt := Commentf("%#v with %#v", vc, policy)
+			c.Assert(b.Clock().Compare(vc.Truncate(policy), vclock.Equal), Equals, true, cmt)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+// Package cbor implements the CBOR (RFC 8949) encoding of vector clocks.
+//
+// A clock is encoded as a map from each id to a map holding its "ticks"
+// and, when non-zero, its "lastUpdate", mirroring the vclock.JSONObject
+// format:
+//
+//	{"idA": {"ticks": 3, "lastUpdate": 17}, "idB": {"ticks": 1}}
+//
+// Encoding is deterministic, with map keys sorted as required by the core
+// deterministic encoding requirements of RFC 8949.
+package cbor
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/jbondeson/vclock"
+	"sort"
+	"unicode/utf8"
+)
+
+// CBOR major types.
+const (
+	majorUint   = 0 << 5
+	majorNegint = 1 << 5
+	majorBytes  = 2 << 5
+	majorText   = 3 << 5
+	majorArray  = 4 << 5
+	majorMap    = 5 << 5
+	majorTag    = 6 << 5
+	majorSimple = 7 << 5
+)
+
+// maxDepth limits the nesting of unknown items skipped while decoding.
+const maxDepth = 16
+
+// null is the CBOR encoding of a nil Clock.
+const null = majorSimple | 22
+
+var errBadCBOR = errors.New("bad vclock cbor")
+
+// Marshal returns the CBOR encoding of vc. Ids are encoded as text
+// strings, so an error is returned if any of them is not valid UTF-8,
+// and Unmarshal likewise rejects text strings that are not.
+func Marshal(vc *vclock.VClock) ([]byte, error) {
+	entries := vc.Entries()
+	for _, e := range entries {
+		if !utf8.ValidString(e.ID) {
+			return nil, errors.New("vclock id is not valid UTF-8")
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		// Shorter keys sort first in encoded form.
+		a, b := entries[i].ID, entries[j].ID
+		return len(a) < len(b) || len(a) == len(b) && a < b
+	})
+	out := appendHead(nil, majorMap, uint64(len(entries)))
+	for _, e := range entries {
+		out = appendText(out, e.ID)
+		if e.LastUpdate == 0 {
+			out = appendHead(out, majorMap, 1)
+		} else {
+			out = appendHead(out, majorMap, 2)
+		}
+		out = appendText(out, "ticks")
+		out = appendHead(out, majorUint, e.Ticks)
+		if e.LastUpdate != 0 {
+			out = appendText(out, "lastUpdate")
+			out = appendHead(out, majorUint, e.LastUpdate)
+		}
+	}
+	return out, nil
+}
+
+// Unmarshal returns the vector clock represented by the CBOR data,
+// which must hold a single map in the format produced by Marshal.
+// Unknown keys within entries are ignored. Inputs larger than
+// vclock.MaxSize are rejected.
+func Unmarshal(data []byte) (*vclock.VClock, error) {
+	if len(data) > vclock.MaxSize {
+		return nil, errBadCBOR
+	}
+	d := decoder{data}
+	n, ok := d.head(majorMap)
+	if !ok || n > uint64(len(d.data)) {
+		return nil, errBadCBOR
+	}
+	entries := make([]vclock.Entry, 0, n)
+	seen := make(map[string]bool, n)
+	for ; n > 0; n-- {
+		id, ok := d.text()
+		if !ok || seen[id] {
+			return nil, errBadCBOR
+		}
+		seen[id] = true
+		entry := vclock.Entry{ID: id}
+		fields, ok := d.head(majorMap)
+		if !ok {
+			return nil, errBadCBOR
+		}
+		for ; fields > 0; fields-- {
+			key, ok := d.text()
+			if !ok {
+				return nil, errBadCBOR
+			}
+			switch key {
+			case "ticks":
+				entry.Ticks, ok = d.uint()
+			case "lastUpdate":
+				entry.LastUpdate, ok = d.uint()
+			default:
+				ok = d.skip(0)
+			}
+			if !ok {
+				return nil, errBadCBOR
+			}
+		}
+		entries = append(entries, entry)
+	}
+	if len(d.data) != 0 {
+		return nil, errBadCBOR
+	}
+	return vclock.FromEntries(entries), nil
+}
+
+// Clock wraps a vector clock so that it is encoded as CBOR when
+// embedded in values marshalled by CBOR libraries supporting the
+// MarshalCBOR and UnmarshalCBOR methods.
+type Clock struct {
+	*vclock.VClock
+}
+
+// MarshalCBOR returns the CBOR encoding of c, which is null when
+// c holds no clock.
+func (c Clock) MarshalCBOR() ([]byte, error) {
+	if c.VClock == nil {
+		return []byte{null}, nil
+	}
+	return Marshal(c.VClock)
+}
+
+// UnmarshalCBOR replaces c with the clock represented by data, or
+// with no clock if data is null.
+func (c *Clock) UnmarshalCBOR(data []byte) error {
+	if len(data) == 1 && data[0] == null {
+		c.VClock = nil
+		return nil
+	}
+	vc, err := Unmarshal(data)
+	if err != nil {
+		return err
+	}
+	c.VClock = vc
+	return nil
+}
+
+func appendHead(out []byte, major byte, value uint64) []byte {
+	switch {
+	case value < 24:
+		return append(out, major|byte(value))
+	case value <= 0xff:
+		return append(out, major|24, byte(value))
+	case value <= 0xffff:
+		return binary.BigEndian.AppendUint16(append(out, major|25), uint16(value))
+	case value <= 0xffffffff:
+		return binary.BigEndian.AppendUint32(append(out, major|26), uint32(value))
+	}
+	return binary.BigEndian.AppendUint64(append(out, major|27), value)
+}
+
+func appendText(out []byte, s string) []byte {
+	return append(appendHead(out, majorText, uint64(len(s))), s...)
+}
+
+type decoder struct {
+	data []byte
+}
+
+// head consumes the head of a data item of the given major type,
+// returning its argument. Indefinite lengths are not supported.
+func (d *decoder) head(major byte) (value uint64, ok bool) {
+	if len(d.data) == 0 || d.data[0]&0xe0 != major {
+		return 0, false
+	}
+	return d.argument()
+}
+
+func (d *decoder) argument() (value uint64, ok bool) {
+	info := d.data[0] & 0x1f
+	d.data = d.data[1:]
+	size := 0
+	switch {
+	case info < 24:
+		return uint64(info), true
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		return 0, false
+	}
+	if len(d.data) < size {
+		return 0, false
+	}
+	for _, b := range d.data[:size] {
+		value = value<<8 | uint64(b)
+	}
+	d.data = d.data[size:]
+	return value, true
+}
+
+func (d *decoder) uint() (uint64, bool) {
+	return d.head(majorUint)
+}
+
+func (d *decoder) text() (string, bool) {
+	size, ok := d.head(majorText)
+	if !ok || size > uint64(len(d.data)) || !utf8.Valid(d.data[:size]) {
+		return "", false
+	}
+	s := string(d.data[:size])
+	d.data = d.data[size:]
+	return s, true
+}
+
+// skip consumes a single data item of any type.
+func (d *decoder) skip(depth int) bool {
+	if len(d.data) == 0 || depth > maxDepth {
+		return false
+	}
+	major := d.data[0] & 0xe0
+	if major == majorSimple {
+		// Simple values and floats carry no nested items.
+		major = majorUint
+	}
+	value, ok := d.argument()
+	if !ok {
+		return false
+	}
+	switch major {
+	case majorBytes, majorText:
+		if value > uint64(len(d.data)) {
+			return false
+		}
+		d.data = d.data[value:]
+	case majorArray, majorMap:
+		if major == majorMap {
+			if value > uint64(len(d.data))/2 {
+				return false
+			}
+			value *= 2
+		}
+		if value > uint64(len(d.data)) {
+			return false
+		}
+		for ; value > 0; value-- {
+			if !d.skip(depth + 1) {
+				return false
+			}
+		}
+	case majorTag:
+		return d.skip(depth + 1)
+	}
+	return true
+}
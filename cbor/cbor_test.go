@@ -0,0 +1,118 @@
+package cbor_test
+
+import (
+	"github.com/jbondeson/vclock"
+	"github.com/jbondeson/vclock/cbor"
+	. "launchpad.net/gocheck"
+	"testing"
+)
+
+func TestAll(c *testing.T) {
+	TestingT(c)
+}
+
+type S struct{}
+
+var _ = Suite(&S{})
+
+func (S) TestMarshal(c *C) {
+	vc := vclock.New()
+	vc.Update("idB", 0)
+	vc.Update("idA", 300)
+	vc.Update("idA", 17)
+	vc.Update("id", 0)
+	data, err := cbor.Marshal(vc)
+	c.Assert(err, IsNil)
+	c.Assert(data, DeepEquals, []byte{
+		0xa3,
+		0x62, 'i', 'd', 0xa1, 0x65, 't', 'i', 'c', 'k', 's', 0x01,
+		0x63, 'i', 'd', 'A', 0xa2, 0x65, 't', 'i', 'c', 'k', 's', 0x02,
+		0x6a, 'l', 'a', 's', 't', 'U', 'p', 'd', 'a', 't', 'e', 0x19, 0x01, 0x2c,
+		0x63, 'i', 'd', 'B', 0xa1, 0x65, 't', 'i', 'c', 'k', 's', 0x01,
+	})
+
+	decoded, err := cbor.Unmarshal(data)
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Compare(vc, vclock.Equal), Equals, true)
+	c.Assert(decoded.LastUpdate(), Equals, uint64(300))
+}
+
+func (S) TestEmpty(c *C) {
+	data, err := cbor.Marshal(vclock.New())
+	c.Assert(err, IsNil)
+	c.Assert(data, DeepEquals, []byte{0xa0})
+	decoded, err := cbor.Unmarshal(data)
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Len(), Equals, 0)
+}
+
+func (S) TestUnknownKeys(c *C) {
+	data := []byte{
+		0xa1, 0x63, 'i', 'd', 'A', 0xa2,
+		0x61, 'x', 0xc1, 0x82, 0xa1, 0x01, 0x41, 0x00, 0xf5,
+		0x65, 't', 'i', 'c', 'k', 's', 0x1b, 0, 0, 0, 1, 0, 0, 0, 0,
+	}
+	vc, err := cbor.Unmarshal(data)
+	c.Assert(err, IsNil)
+	c.Assert(vc.Entries(), DeepEquals, []vclock.Entry{{ID: "idA", Ticks: 1 << 32}})
+}
+
+func (S) TestUnmarshalWithBadData(c *C) {
+	for _, data := range [][]byte{
+		{},
+		{0x80},
+		{0xbf, 0xff},
+		{0xa1, 0x63, 'i', 'd'},
+		{0xa1, 0x43, 'i', 'd', 'A', 0xa0},
+		{0xa1, 0x63, 'i', 'd', 'A', 0xa1, 0x65, 't', 'i', 'c', 'k', 's', 0x20},
+		{0xa2, 0x61, 'A', 0xa0, 0x61, 'A', 0xa0},
+		{0xa1, 0x61, 'A', 0xa0, 0x00},
+		{0xbb, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+	} {
+		vc, err := cbor.Unmarshal(data)
+		c.Assert(err, ErrorMatches, "bad vclock cbor", Commentf("%x", data))
+		c.Assert(vc, IsNil)
+	}
+}
+
+func (S) TestUnmarshalSizeLimit(c *C) {
+	data := make([]byte, vclock.MaxSize+1)
+	data[0] = 0xa0
+	_, err := cbor.Unmarshal(data)
+	c.Assert(err, ErrorMatches, "bad vclock cbor")
+}
+
+func (S) TestClock(c *C) {
+	vc := vclock.New()
+	vc.Update("idA", 1)
+	data, err := cbor.Clock{vc}.MarshalCBOR()
+	c.Assert(err, IsNil)
+
+	var clock cbor.Clock
+	err = clock.UnmarshalCBOR(data)
+	c.Assert(err, IsNil)
+	c.Assert(clock.Compare(vc, vclock.Equal), Equals, true)
+}
+
+func (S) TestNilClock(c *C) {
+	data, err := cbor.Clock{}.MarshalCBOR()
+	c.Assert(err, IsNil)
+	c.Assert(data, DeepEquals, []byte{0xf6})
+
+	clock := cbor.Clock{vclock.New()}
+	err = clock.UnmarshalCBOR(data)
+	c.Assert(err, IsNil)
+	c.Assert(clock.VClock, IsNil)
+}
+
+func (S) TestInvalidUTF8(c *C) {
+	vc := vclock.New()
+	vc.Update("\xff\xfe", 1)
+	data, err := cbor.Marshal(vc)
+	c.Assert(err, ErrorMatches, "vclock id is not valid UTF-8")
+	c.Assert(data, IsNil)
+
+	vc, err = cbor.Unmarshal([]byte{0xa1, 0x62, 0xff, 0xfe, 0xa0})
+	c.Assert(err, ErrorMatches, "bad vclock cbor")
+	c.Assert(vc, IsNil)
+}
@@ -0,0 +1,110 @@
+package vclock_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/jbondeson/vclock"
+	. "launchpad.net/gocheck"
+	"os"
+)
+
+type conformanceVector struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Entries     []vclock.Entry  `json:"entries"`
+	Binary      string          `json:"binary"`
+	JSON        json.RawMessage `json:"json"`
+	JSONObject  json.RawMessage `json:"jsonObject"`
+	JSONCompact json.RawMessage `json:"jsonCompact"`
+	String      string          `json:"string"`
+}
+
+type conformanceComparison struct {
+	A        string `json:"a"`
+	B        string `json:"b"`
+	Relation string `json:"relation"`
+}
+
+type conformanceCorpus struct {
+	Version     int                     `json:"version"`
+	Vectors     []conformanceVector     `json:"vectors"`
+	Comparisons []conformanceComparison `json:"comparisons"`
+}
+
+var conformanceRelations = map[string]vclock.Condition{
+	"equal":      vclock.Equal,
+	"ancestor":   vclock.Ancestor,
+	"descendant": vclock.Descendant,
+	"concurrent": vclock.Concurrent,
+}
+
+func loadConformance(c *C, path string) *conformanceCorpus {
+	data, err := os.ReadFile(path)
+	c.Assert(err, IsNil)
+	var corpus conformanceCorpus
+	c.Assert(json.Unmarshal(data, &corpus), IsNil)
+	return &corpus
+}
+
+func compactJSON(c *C, data []byte) string {
+	var buf bytes.Buffer
+	c.Assert(json.Compact(&buf, data), IsNil)
+	return buf.String()
+}
+
+func (S) TestConformanceV1(c *C) {
+	corpus := loadConformance(c, "testdata/conformance/v1.json")
+	c.Assert(corpus.Version, Equals, 1)
+
+	clocks := make(map[string]*vclock.VClock)
+	for _, v := range corpus.Vectors {
+		cmt := Commentf("vector %s", v.Name)
+		vc := vclock.FromEntries(v.Entries)
+		clocks[v.Name] = vc
+
+		binary, err := hex.DecodeString(v.Binary)
+		c.Assert(err, IsNil, cmt)
+		c.Assert(vc.Bytes(), DeepEquals, binary, cmt)
+		decoded, err := vclock.FromBytes(binary)
+		c.Assert(err, IsNil, cmt)
+		c.Assert(decoded.Entries(), DeepEquals, vc.Entries(), cmt)
+
+		c.Assert(vc.String(), Equals, v.String, cmt)
+		parsed, err := vclock.ParseString(v.String)
+		c.Assert(err, IsNil, cmt)
+		c.Assert(parsed.Compare(vc, vclock.Equal), Equals, true, cmt)
+
+		forms := []struct {
+			format vclock.JSONFormat
+			data   json.RawMessage
+		}{
+			{vclock.JSONBytes, v.JSON},
+			{vclock.JSONObject, v.JSONObject},
+			{vclock.JSONCompact, v.JSONCompact},
+		}
+		for _, form := range forms {
+			vc.SetJSONFormat(form.format)
+			data, err := json.Marshal(vc)
+			c.Assert(err, IsNil, cmt)
+			c.Assert(string(data), Equals, compactJSON(c, form.data), cmt)
+
+			decoded := vclock.New()
+			c.Assert(json.Unmarshal(form.data, decoded), IsNil, cmt)
+			c.Assert(decoded.Compare(vc, vclock.Equal), Equals, true, cmt)
+		}
+		vc.SetJSONFormat(vclock.JSONBytes)
+	}
+
+	for _, cmp := range corpus.Comparisons {
+		cmt := Commentf("%s compared to %s", cmp.B, cmp.A)
+		a, b := clocks[cmp.A], clocks[cmp.B]
+		c.Assert(a, NotNil, cmt)
+		c.Assert(b, NotNil, cmt)
+		relation, ok := conformanceRelations[cmp.Relation]
+		c.Assert(ok, Equals, true, cmt)
+		for _, cond := range conformanceRelations {
+			c.Assert(a.Compare(b, cond), Equals, cond == relation, cmt)
+		}
+	}
+}
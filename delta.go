@@ -0,0 +1,187 @@
+package vclock
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"sort"
+)
+
+// ErrDeltaBase is returned by ApplyDelta when the delta was encoded
+// against a base other than the one provided.
+var ErrDeltaBase = errors.New("vclock delta base mismatch")
+
+var errBadDelta = errors.New("bad vclock delta")
+
+// EncodeDelta returns a serialized representation of vc relative to base,
+// holding only the entries of vc whose ticks or update time differ from
+// those in base, and the ids of base which vc lacks. The returned data may
+// be turned back into vc by ApplyDelta, given the same base.
+//
+// The format of the delta is:
+//
+//	[ header byte | base fingerprint | watermark | N | [ ticks | time | id len | id ] * N | M | [ id len | id ] * M ]
+//
+// where the time is present only if the header has the 0x1 bit set, and
+// the pruning watermark of vc only if it has the 0x2 bit set, as in
+// PrunedBytes, and the fingerprint is 8 bytes long.
+func EncodeDelta(base, vc *VClock) []byte {
+	var changed []*itemType
+	var removed []string
+	for i := range vc.items {
+		item := &vc.items[i]
+		bi, found := base.findItem(item.id)
+		if !found || base.items[bi].ticks != item.ticks || base.items[bi].lastUpdate != item.lastUpdate {
+			changed = append(changed, item)
+		}
+	}
+	for i := range base.items {
+		if _, found := vc.findItem(base.items[i].id); !found {
+			removed = append(removed, base.items[i].id)
+		}
+	}
+
+	size := 1 + 8 + prunedSize(vc.pruned, vc.watermark) + packedIntSize(uint64(len(changed))) + packedIntSize(uint64(len(removed)))
+	for _, item := range changed {
+		size += packedIntSize(item.ticks) + packedIntSize(uint64(len(item.id))) + len(item.id)
+		if vc.hasUpdateTime {
+			size += packedIntSize(item.lastUpdate)
+		}
+	}
+	for _, id := range removed {
+		size += packedIntSize(uint64(len(id))) + len(id)
+	}
+
+	result := make([]byte, size)
+	if vc.hasUpdateTime {
+		result[0] |= 0x1
+	}
+	binary.BigEndian.PutUint64(result[1:], base.fingerprint())
+	pos := 9
+	if vc.pruned {
+		result[0] |= 0x2
+		pos += packInt(vc.watermark, result[pos:])
+	}
+	pos += packInt(uint64(len(changed)), result[pos:])
+	for _, item := range changed {
+		pos += packInt(item.ticks, result[pos:])
+		if vc.hasUpdateTime {
+			pos += packInt(item.lastUpdate, result[pos:])
+		}
+		pos += packInt(uint64(len(item.id)), result[pos:])
+		pos += copy(result[pos:], item.id)
+	}
+	pos += packInt(uint64(len(removed)), result[pos:])
+	for _, id := range removed {
+		pos += packInt(uint64(len(id)), result[pos:])
+		pos += copy(result[pos:], id)
+	}
+	return result
+}
+
+// ApplyDelta returns the vector clock represented by delta relative to
+// base, which must have been generated by EncodeDelta with an equal base.
+// If base differs from the one the delta was encoded against,
+// ErrDeltaBase is returned.
+func ApplyDelta(base *VClock, delta []byte) (*VClock, error) {
+	if len(delta) < 9 || delta[0]&^0x03 != 0 {
+		return nil, errBadDelta
+	}
+	if binary.BigEndian.Uint64(delta[1:]) != base.fingerprint() {
+		return nil, ErrDeltaBase
+	}
+	vc := base.Copy()
+	vc.hasUpdateTime = delta[0]&0x01 != 0
+	data := delta[9:]
+	vc.pruned, vc.watermark = false, 0
+	if delta[0]&0x02 != 0 {
+		watermark, size, ok := unpackInt(data)
+		if !ok {
+			return nil, errBadDelta
+		}
+		data = data[size:]
+		vc.setPruned(watermark)
+	}
+	n, size, ok := unpackInt(data)
+	if !ok {
+		return nil, errBadDelta
+	}
+	data = data[size:]
+	for ; n > 0; n-- {
+		ticks, size, ok := unpackInt(data)
+		if !ok {
+			return nil, errBadDelta
+		}
+		data = data[size:]
+		lastUpdate := uint64(0)
+		if vc.hasUpdateTime {
+			if lastUpdate, size, ok = unpackInt(data); !ok {
+				return nil, errBadDelta
+			}
+			data = data[size:]
+		}
+		id, rest, ok := unpackID(data)
+		if !ok {
+			return nil, errBadDelta
+		}
+		data = rest
+		if i, found := vc.findItem(id); found {
+			vc.items[i].ticks = ticks
+			vc.items[i].lastUpdate = lastUpdate
+		} else {
+			vc.updateItem(id, ticks, lastUpdate)
+		}
+	}
+	m, size, ok := unpackInt(data)
+	if !ok {
+		return nil, errBadDelta
+	}
+	data = data[size:]
+	for ; m > 0; m-- {
+		id, rest, ok := unpackID(data)
+		if !ok {
+			return nil, errBadDelta
+		}
+		data = rest
+		i, found := vc.findItem(id)
+		if !found {
+			return nil, errBadDelta
+		}
+		vc.items = append(vc.items[:i], vc.items[i+1:]...)
+	}
+	if len(data) != 0 {
+		return nil, errBadDelta
+	}
+	return vc, nil
+}
+
+// unpackID unpacks a length-prefixed id from data, returning it along
+// with the remaining data.
+func unpackID(data []byte) (id string, rest []byte, ok bool) {
+	idLen, size, ok := unpackInt(data)
+	if !ok || idLen > uint64(len(data)-size) {
+		return "", nil, false
+	}
+	data = data[size:]
+	return string(data[:idLen]), data[idLen:], true
+}
+
+// fingerprint returns a hash of the entries in vc which does not depend
+// on the order in which they are held.
+func (vc *VClock) fingerprint() uint64 {
+	items := make([]*itemType, len(vc.items))
+	for i := range vc.items {
+		items[i] = &vc.items[i]
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].id < items[j].id })
+	h := fnv.New64a()
+	var buf [3 * maxPackedIntSize]byte
+	for _, item := range items {
+		n := packInt(item.ticks, buf[:])
+		n += packInt(item.lastUpdate, buf[n:])
+		n += packInt(uint64(len(item.id)), buf[n:])
+		h.Write(buf[:n])
+		h.Write([]byte(item.id))
+	}
+	return h.Sum64()
+}
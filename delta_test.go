@@ -0,0 +1,104 @@
+package vclock_test
+
+import (
+	"github.com/jbondeson/vclock"
+	. "launchpad.net/gocheck"
+)
+
+func (S) TestDeltaRoundTrip(c *C) {
+	base := vclock.New()
+	for _, id := range []string{"idA", "idB", "idC", "idD", "idE"} {
+		base.Update(id, 10)
+	}
+	vc := base.Copy()
+	vc.Update("idB", 12)
+	vc.Update("idF", 13)
+
+	delta := vclock.EncodeDelta(base, vc)
+	c.Assert(len(delta) < len(vc.Bytes()), Equals, true)
+
+	applied, err := vclock.ApplyDelta(base, delta)
+	c.Assert(err, IsNil)
+	c.Assert(applied.Bytes(), DeepEquals, vc.Bytes())
+}
+
+func (S) TestDeltaUnchanged(c *C) {
+	base := vclock.New()
+	base.Update("idA", 1)
+	delta := vclock.EncodeDelta(base, base.Copy())
+	// Header, fingerprint, and two empty counts.
+	c.Assert(len(delta), Equals, 11)
+
+	applied, err := vclock.ApplyDelta(base, delta)
+	c.Assert(err, IsNil)
+	c.Assert(applied.Compare(base, vclock.Equal), Equals, true)
+}
+
+func (S) TestDeltaRemovedEntries(c *C) {
+	base := vclock.New()
+	base.Update("idA", 1)
+	base.Update("idB", 2)
+	base.Update("idC", 3)
+	vc := base.Truncate(&vclock.Truncation{CutBefore: 3})
+	vc.Update("idC", 4)
+
+	applied, err := vclock.ApplyDelta(base, vclock.EncodeDelta(base, vc))
+	c.Assert(err, IsNil)
+	c.Assert(applied.Bytes(), DeepEquals, vc.Bytes())
+}
+
+func (S) TestDeltaOrderIndependentBase(c *C) {
+	base1 := vclock.New()
+	base1.Update("idA", 1)
+	base1.Update("idB", 2)
+	base2 := vclock.New()
+	base2.Update("idB", 2)
+	base2.Update("idA", 1)
+	vc := base1.Copy()
+	vc.Update("idA", 3)
+
+	applied, err := vclock.ApplyDelta(base2, vclock.EncodeDelta(base1, vc))
+	c.Assert(err, IsNil)
+	c.Assert(applied.Compare(vc, vclock.Equal), Equals, true)
+	c.Assert(applied.LastUpdate(), Equals, uint64(3))
+}
+
+func (S) TestDeltaBaseMismatch(c *C) {
+	base := vclock.New()
+	base.Update("idA", 1)
+	vc := base.Copy()
+	vc.Update("idB", 2)
+	delta := vclock.EncodeDelta(base, vc)
+
+	other := base.Copy()
+	other.Update("idA", 1)
+	applied, err := vclock.ApplyDelta(other, delta)
+	c.Assert(err, Equals, vclock.ErrDeltaBase)
+	c.Assert(applied, IsNil)
+
+	// A different update time alone is also a different base.
+	other = vclock.New()
+	other.Update("idA", 2)
+	_, err = vclock.ApplyDelta(other, delta)
+	c.Assert(err, Equals, vclock.ErrDeltaBase)
+}
+
+func (S) TestDeltaBadData(c *C) {
+	base := vclock.New()
+	base.Update("idA", 1)
+	vc := base.Copy()
+	vc.Update("idB", 2)
+	delta := vclock.EncodeDelta(base, vc)
+
+	for _, bad := range [][]byte{
+		{},
+		delta[:5],
+		delta[:len(delta)-1],
+		append(append([]byte{}, delta...), 0),
+		append([]byte{4}, delta[1:]...),
+	} {
+		applied, err := vclock.ApplyDelta(base, bad)
+		c.Assert(err, ErrorMatches, "bad vclock delta", Commentf("%v", bad))
+		c.Assert(applied, IsNil)
+	}
+}
@@ -0,0 +1,51 @@
+// Package protowire splits Protocol Buffers messages into their fields,
+// for the codecs of the vclock packages.
+package protowire
+
+import (
+	"encoding/binary"
+)
+
+// Wire types.
+const (
+	Varint  = 0
+	Fixed64 = 1
+	Bytes   = 2
+	Fixed32 = 5
+)
+
+// Next splits the first field off data, returning its field number, wire
+// type, and value. The value of varint fields is returned in its encoded
+// form, and the value of length-delimited fields without the length prefix.
+func Next(data []byte) (field uint64, wire int, value, rest []byte, ok bool) {
+	key, n := binary.Uvarint(data)
+	if n <= 0 || key>>3 == 0 {
+		return 0, 0, nil, nil, false
+	}
+	field, wire, data = key>>3, int(key&7), data[n:]
+	size := 0
+	switch wire {
+	case Varint:
+		if _, n = binary.Uvarint(data); n <= 0 {
+			return 0, 0, nil, nil, false
+		}
+		size = n
+	case Fixed64:
+		size = 8
+	case Fixed32:
+		size = 4
+	case Bytes:
+		length, n := binary.Uvarint(data)
+		if n <= 0 || length > uint64(len(data)-n) {
+			return 0, 0, nil, nil, false
+		}
+		data = data[n:]
+		size = int(length)
+	default:
+		return 0, 0, nil, nil, false
+	}
+	if size > len(data) {
+		return 0, 0, nil, nil, false
+	}
+	return field, wire, data[:size], data[size:], true
+}
@@ -0,0 +1,53 @@
+package protowire_test
+
+import (
+	"github.com/jbondeson/vclock/internal/protowire"
+	. "launchpad.net/gocheck"
+	"testing"
+)
+
+func TestAll(c *testing.T) {
+	TestingT(c)
+}
+
+type S struct{}
+
+var _ = Suite(&S{})
+
+func (S) TestNext(c *C) {
+	data := []byte{
+		1<<3 | protowire.Varint, 0xac, 0x02,
+		2<<3 | protowire.Fixed64, 1, 2, 3, 4, 5, 6, 7, 8,
+		3<<3 | protowire.Bytes, 2, 'h', 'i',
+		15<<3 | protowire.Fixed32, 1, 2, 3, 4,
+	}
+	var fields []uint64
+	var wires []int
+	var values [][]byte
+	for len(data) > 0 {
+		field, wire, value, rest, ok := protowire.Next(data)
+		c.Assert(ok, Equals, true)
+		fields = append(fields, field)
+		wires = append(wires, wire)
+		values = append(values, value)
+		data = rest
+	}
+	c.Assert(fields, DeepEquals, []uint64{1, 2, 3, 15})
+	c.Assert(wires, DeepEquals, []int{protowire.Varint, protowire.Fixed64, protowire.Bytes, protowire.Fixed32})
+	c.Assert(values, DeepEquals, [][]byte{{0xac, 0x02}, {1, 2, 3, 4, 5, 6, 7, 8}, {'h', 'i'}, {1, 2, 3, 4}})
+}
+
+func (S) TestNextWithBadData(c *C) {
+	for _, data := range [][]byte{
+		{},
+		{0 << 3},
+		{1<<3 | 3},
+		{1<<3 | protowire.Varint, 0x80},
+		{1<<3 | protowire.Fixed64, 1, 2, 3},
+		{1<<3 | protowire.Bytes, 3, 'h', 'i'},
+		{1<<3 | protowire.Fixed32, 1},
+	} {
+		_, _, _, _, ok := protowire.Next(data)
+		c.Assert(ok, Equals, false, Commentf("%v", data))
+	}
+}
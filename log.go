@@ -0,0 +1,71 @@
+package vclock
+
+import (
+	"log/slog"
+	"sort"
+)
+
+// LogOptions defines how a vector clock is rendered for structured logging.
+type LogOptions struct {
+	// Times renders each id as a group holding its ticks and its
+	// lastUpdate time, rather than as its ticks alone.
+	Times bool
+
+	// If the vector clock has more than MaxEntries entries, only the
+	// MaxEntries most recently updated ones are rendered, within an
+	// "entries" attribute, alongside the total "size" of the clock and
+	// the number of entries "omitted". Zero means no limit.
+	MaxEntries int
+}
+
+// log/slog.LogValuer interface
+//
+// The clock is rendered as a group with an id=ticks attribute per entry,
+// sorted by id. A nil clock is rendered as "<nil>".
+func (vc *VClock) LogValue() slog.Value {
+	return vc.logValue(LogOptions{})
+}
+
+// LogValuer returns a slog.LogValuer rendering vc as defined by opts.
+func (vc *VClock) LogValuer(opts LogOptions) slog.LogValuer {
+	return logValuer{vc, opts}
+}
+
+type logValuer struct {
+	vc   *VClock
+	opts LogOptions
+}
+
+func (lv logValuer) LogValue() slog.Value {
+	return lv.vc.logValue(lv.opts)
+}
+
+func (vc *VClock) logValue(opts LogOptions) slog.Value {
+	if vc == nil {
+		return slog.StringValue("<nil>")
+	}
+	items := vc.sortedByID()
+	omitted := 0
+	if opts.MaxEntries > 0 && len(items) > opts.MaxEntries {
+		sort.SliceStable(items, func(i, j int) bool { return items[i].lastUpdate > items[j].lastUpdate })
+		omitted = len(items) - opts.MaxEntries
+		items = items[:opts.MaxEntries]
+		sort.Slice(items, func(i, j int) bool { return items[i].id < items[j].id })
+	}
+	attrs := make([]slog.Attr, len(items))
+	for i, item := range items {
+		if opts.Times {
+			attrs[i] = slog.Group(item.id, slog.Uint64("ticks", item.ticks), slog.Uint64("lastUpdate", item.lastUpdate))
+		} else {
+			attrs[i] = slog.Uint64(item.id, item.ticks)
+		}
+	}
+	if omitted == 0 {
+		return slog.GroupValue(attrs...)
+	}
+	return slog.GroupValue(
+		slog.Int("size", len(vc.items)),
+		slog.Int("omitted", omitted),
+		slog.Attr{Key: "entries", Value: slog.GroupValue(attrs...)},
+	)
+}
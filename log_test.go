@@ -0,0 +1,61 @@
+package vclock_test
+
+import (
+	"bytes"
+	"github.com/jbondeson/vclock"
+	. "launchpad.net/gocheck"
+	"log/slog"
+)
+
+func logLine(args ...interface{}) string {
+	var buf bytes.Buffer
+	handler := slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && (a.Key == slog.TimeKey || a.Key == slog.LevelKey) {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	slog.New(handler).Info("conflict", args...)
+	return buf.String()
+}
+
+func logTestClock() *vclock.VClock {
+	vc := vclock.New()
+	vc.Update("idC", 3)
+	vc.Update("idA", 5)
+	vc.Update("idA", 17)
+	vc.Update("idB", 9)
+	return vc
+}
+
+func (S) TestLogValue(c *C) {
+	c.Assert(logLine("vclock", logTestClock()), Equals,
+		"msg=conflict vclock.idA=2 vclock.idB=1 vclock.idC=1\n")
+}
+
+func (S) TestLogValuerTimes(c *C) {
+	vc := logTestClock()
+	c.Assert(logLine("vclock", vc.LogValuer(vclock.LogOptions{Times: true})), Equals,
+		"msg=conflict vclock.idA.ticks=2 vclock.idA.lastUpdate=17 vclock.idB.ticks=1 vclock.idB.lastUpdate=9 vclock.idC.ticks=1 vclock.idC.lastUpdate=3\n")
+}
+
+func (S) TestLogValuerMaxEntries(c *C) {
+	vc := logTestClock()
+	c.Assert(logLine("vclock", vc.LogValuer(vclock.LogOptions{MaxEntries: 3})), Equals,
+		"msg=conflict vclock.idA=2 vclock.idB=1 vclock.idC=1\n")
+	c.Assert(logLine("vclock", vc.LogValuer(vclock.LogOptions{MaxEntries: 2})), Equals,
+		"msg=conflict vclock.size=3 vclock.omitted=1 vclock.entries.idA=2 vclock.entries.idB=1\n")
+}
+
+func (S) TestLogValueNil(c *C) {
+	var vc *vclock.VClock
+	c.Assert(logLine("vclock", vc), Equals, "msg=conflict vclock=<nil>\n")
+	c.Assert(logLine("vclock", vc.LogValuer(vclock.LogOptions{Times: true})), Equals, "msg=conflict vclock=<nil>\n")
+}
+
+func (S) TestLogValueEmpty(c *C) {
+	// Empty groups are elided by handlers.
+	c.Assert(logLine("vclock", vclock.New()), Equals, "msg=conflict\n")
+}
@@ -0,0 +1,334 @@
+// Package msgpack implements the MessagePack encoding of vector clocks.
+//
+// A clock is encoded as a map from each id to a map holding its "ticks"
+// and, when non-zero, its "lastUpdate", mirroring the vclock.JSONObject
+// format:
+//
+//	{"idA": {"ticks": 3, "lastUpdate": 17}, "idB": {"ticks": 1}}
+//
+// Encoding is deterministic, with ids sorted in ascending order.
+package msgpack
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/jbondeson/vclock"
+	"sort"
+	"unicode/utf8"
+)
+
+// maxDepth limits the nesting of unknown values skipped while decoding.
+const maxDepth = 16
+
+// nilValue is the MessagePack encoding of a nil Clock.
+const nilValue = 0xc0
+
+var errBadMsgpack = errors.New("bad vclock msgpack")
+
+// Marshal returns the MessagePack encoding of vc. Ids are encoded as
+// strings, so an error is returned if any of them is not valid UTF-8,
+// and Unmarshal likewise rejects strings that are not.
+func Marshal(vc *vclock.VClock) ([]byte, error) {
+	entries := vc.Entries()
+	for _, e := range entries {
+		if !utf8.ValidString(e.ID) {
+			return nil, errors.New("vclock id is not valid UTF-8")
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	out := appendMapHeader(nil, uint32(len(entries)))
+	for _, e := range entries {
+		out = appendString(out, e.ID)
+		if e.LastUpdate == 0 {
+			out = appendMapHeader(out, 1)
+		} else {
+			out = appendMapHeader(out, 2)
+		}
+		out = appendString(out, "ticks")
+		out = appendUint(out, e.Ticks)
+		if e.LastUpdate != 0 {
+			out = appendString(out, "lastUpdate")
+			out = appendUint(out, e.LastUpdate)
+		}
+	}
+	return out, nil
+}
+
+// Unmarshal returns the vector clock represented by the MessagePack
+// data, which must hold a single map in the format produced by Marshal.
+// Unknown keys within entries are ignored. Inputs larger than
+// vclock.MaxSize are rejected.
+func Unmarshal(data []byte) (*vclock.VClock, error) {
+	if len(data) > vclock.MaxSize {
+		return nil, errBadMsgpack
+	}
+	d := decoder{data}
+	n, ok := d.mapHeader()
+	if !ok || uint64(n) > uint64(len(d.data)) {
+		return nil, errBadMsgpack
+	}
+	entries := make([]vclock.Entry, 0, n)
+	seen := make(map[string]bool, n)
+	for ; n > 0; n-- {
+		id, ok := d.string()
+		if !ok || seen[id] {
+			return nil, errBadMsgpack
+		}
+		seen[id] = true
+		entry := vclock.Entry{ID: id}
+		fields, ok := d.mapHeader()
+		if !ok {
+			return nil, errBadMsgpack
+		}
+		for ; fields > 0; fields-- {
+			key, ok := d.string()
+			if !ok {
+				return nil, errBadMsgpack
+			}
+			switch key {
+			case "ticks":
+				entry.Ticks, ok = d.uint()
+			case "lastUpdate":
+				entry.LastUpdate, ok = d.uint()
+			default:
+				ok = d.skip(0)
+			}
+			if !ok {
+				return nil, errBadMsgpack
+			}
+		}
+		entries = append(entries, entry)
+	}
+	if len(d.data) != 0 {
+		return nil, errBadMsgpack
+	}
+	return vclock.FromEntries(entries), nil
+}
+
+// Clock wraps a vector clock so that it is encoded as MessagePack when
+// embedded in values marshalled by MessagePack libraries supporting the
+// MarshalMsgpack and UnmarshalMsgpack methods.
+type Clock struct {
+	*vclock.VClock
+}
+
+// MarshalMsgpack returns the MessagePack encoding of c, which is nil
+// when c holds no clock.
+func (c Clock) MarshalMsgpack() ([]byte, error) {
+	if c.VClock == nil {
+		return []byte{nilValue}, nil
+	}
+	return Marshal(c.VClock)
+}
+
+// UnmarshalMsgpack replaces c with the clock represented by data, or
+// with no clock if data is nil.
+func (c *Clock) UnmarshalMsgpack(data []byte) error {
+	if len(data) == 1 && data[0] == nilValue {
+		c.VClock = nil
+		return nil
+	}
+	vc, err := Unmarshal(data)
+	if err != nil {
+		return err
+	}
+	c.VClock = vc
+	return nil
+}
+
+func appendMapHeader(out []byte, n uint32) []byte {
+	switch {
+	case n < 16:
+		return append(out, 0x80|byte(n))
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16(append(out, 0xde), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(out, 0xdf), n)
+}
+
+func appendString(out []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n < 32:
+		out = append(out, 0xa0|byte(n))
+	case n <= 0xff:
+		out = append(out, 0xd9, byte(n))
+	case n <= 0xffff:
+		out = binary.BigEndian.AppendUint16(append(out, 0xda), uint16(n))
+	default:
+		out = binary.BigEndian.AppendUint32(append(out, 0xdb), uint32(n))
+	}
+	return append(out, s...)
+}
+
+func appendUint(out []byte, value uint64) []byte {
+	switch {
+	case value < 128:
+		return append(out, byte(value))
+	case value <= 0xff:
+		return append(out, 0xcc, byte(value))
+	case value <= 0xffff:
+		return binary.BigEndian.AppendUint16(append(out, 0xcd), uint16(value))
+	case value <= 0xffffffff:
+		return binary.BigEndian.AppendUint32(append(out, 0xce), uint32(value))
+	}
+	return binary.BigEndian.AppendUint64(append(out, 0xcf), value)
+}
+
+type decoder struct {
+	data []byte
+}
+
+// fixed consumes and returns the big-endian integer in the next size bytes.
+func (d *decoder) fixed(size int) (value uint64, ok bool) {
+	if len(d.data) < size {
+		return 0, false
+	}
+	for _, b := range d.data[:size] {
+		value = value<<8 | uint64(b)
+	}
+	d.data = d.data[size:]
+	return value, true
+}
+
+func (d *decoder) next() (b byte, ok bool) {
+	if len(d.data) == 0 {
+		return 0, false
+	}
+	b, d.data = d.data[0], d.data[1:]
+	return b, true
+}
+
+func (d *decoder) mapHeader() (n uint32, ok bool) {
+	b, ok := d.next()
+	var value uint64
+	switch {
+	case !ok:
+	case b&0xf0 == 0x80:
+		return uint32(b & 0x0f), true
+	case b == 0xde:
+		value, ok = d.fixed(2)
+		return uint32(value), ok
+	case b == 0xdf:
+		value, ok = d.fixed(4)
+		return uint32(value), ok
+	}
+	return 0, false
+}
+
+func (d *decoder) string() (s string, ok bool) {
+	b, ok := d.next()
+	var size uint64
+	switch {
+	case !ok:
+		return "", false
+	case b&0xe0 == 0xa0:
+		size = uint64(b & 0x1f)
+	case b == 0xd9:
+		size, ok = d.fixed(1)
+	case b == 0xda:
+		size, ok = d.fixed(2)
+	case b == 0xdb:
+		size, ok = d.fixed(4)
+	default:
+		return "", false
+	}
+	if !ok || size > uint64(len(d.data)) || !utf8.Valid(d.data[:size]) {
+		return "", false
+	}
+	s, d.data = string(d.data[:size]), d.data[size:]
+	return s, true
+}
+
+func (d *decoder) uint() (value uint64, ok bool) {
+	b, ok := d.next()
+	switch {
+	case !ok:
+		return 0, false
+	case b < 0x80:
+		return uint64(b), true
+	case b == 0xcc:
+		return d.fixed(1)
+	case b == 0xcd:
+		return d.fixed(2)
+	case b == 0xce:
+		return d.fixed(4)
+	case b == 0xcf:
+		return d.fixed(8)
+	}
+	return 0, false
+}
+
+// skip consumes a single value of any type.
+func (d *decoder) skip(depth int) bool {
+	b, ok := d.next()
+	if !ok || depth > maxDepth {
+		return false
+	}
+	var size, items uint64
+	switch {
+	case b < 0x80 || b >= 0xe0 || b == 0xc0 || b == 0xc2 || b == 0xc3:
+		// Fixint, nil, and booleans.
+	case b&0xf0 == 0x80:
+		items = 2 * uint64(b&0x0f)
+	case b&0xf0 == 0x90:
+		items = uint64(b & 0x0f)
+	case b&0xe0 == 0xa0:
+		size = uint64(b & 0x1f)
+	case b == 0xcc || b == 0xd0:
+		size = 1
+	case b == 0xcd || b == 0xd1:
+		size = 2
+	case b == 0xca || b == 0xce || b == 0xd2:
+		size = 4
+	case b == 0xcb || b == 0xcf || b == 0xd3:
+		size = 8
+	case b == 0xd4:
+		size = 2
+	case b == 0xd5:
+		size = 3
+	case b == 0xd6:
+		size = 5
+	case b == 0xd7:
+		size = 9
+	case b == 0xd8:
+		size = 17
+	case b == 0xc4 || b == 0xd9:
+		size, ok = d.fixed(1)
+	case b == 0xc5 || b == 0xda:
+		size, ok = d.fixed(2)
+	case b == 0xc6 || b == 0xdb:
+		size, ok = d.fixed(4)
+	case b == 0xc7:
+		size, ok = d.fixed(1)
+		size++
+	case b == 0xc8:
+		size, ok = d.fixed(2)
+		size++
+	case b == 0xc9:
+		size, ok = d.fixed(4)
+		size++
+	case b == 0xdc:
+		items, ok = d.fixed(2)
+	case b == 0xdd:
+		items, ok = d.fixed(4)
+	case b == 0xde:
+		items, ok = d.fixed(2)
+		items *= 2
+	case b == 0xdf:
+		items, ok = d.fixed(4)
+		items *= 2
+	default:
+		return false
+	}
+	if !ok || size > uint64(len(d.data)) || items > uint64(len(d.data)) {
+		return false
+	}
+	d.data = d.data[size:]
+	for ; items > 0; items-- {
+		if !d.skip(depth + 1) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,115 @@
+package msgpack_test
+
+import (
+	"github.com/jbondeson/vclock"
+	"github.com/jbondeson/vclock/msgpack"
+	. "launchpad.net/gocheck"
+	"testing"
+)
+
+func TestAll(c *testing.T) {
+	TestingT(c)
+}
+
+type S struct{}
+
+var _ = Suite(&S{})
+
+func (S) TestMarshal(c *C) {
+	vc := vclock.New()
+	vc.Update("idB", 0)
+	vc.Update("idA", 300)
+	vc.Update("idA", 17)
+	data, err := msgpack.Marshal(vc)
+	c.Assert(err, IsNil)
+	c.Assert(data, DeepEquals, []byte{
+		0x82,
+		0xa3, 'i', 'd', 'A', 0x82, 0xa5, 't', 'i', 'c', 'k', 's', 0x02,
+		0xaa, 'l', 'a', 's', 't', 'U', 'p', 'd', 'a', 't', 'e', 0xcd, 0x01, 0x2c,
+		0xa3, 'i', 'd', 'B', 0x81, 0xa5, 't', 'i', 'c', 'k', 's', 0x01,
+	})
+
+	decoded, err := msgpack.Unmarshal(data)
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Compare(vc, vclock.Equal), Equals, true)
+	c.Assert(decoded.LastUpdate(), Equals, uint64(300))
+}
+
+func (S) TestEmpty(c *C) {
+	data, err := msgpack.Marshal(vclock.New())
+	c.Assert(err, IsNil)
+	c.Assert(data, DeepEquals, []byte{0x80})
+	decoded, err := msgpack.Unmarshal(data)
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Len(), Equals, 0)
+}
+
+func (S) TestUnknownKeys(c *C) {
+	data := []byte{
+		0x81, 0xa3, 'i', 'd', 'A', 0x82,
+		0xa1, 'x', 0x92, 0x81, 0x01, 0xc4, 0x01, 0x00, 0xd6, 0x01, 1, 2, 3, 4,
+		0xa5, 't', 'i', 'c', 'k', 's', 0xcf, 0, 0, 0, 1, 0, 0, 0, 0,
+	}
+	vc, err := msgpack.Unmarshal(data)
+	c.Assert(err, IsNil)
+	c.Assert(vc.Entries(), DeepEquals, []vclock.Entry{{ID: "idA", Ticks: 1 << 32}})
+}
+
+func (S) TestUnmarshalWithBadData(c *C) {
+	for _, data := range [][]byte{
+		{},
+		{0x90},
+		{0x81, 0xa3, 'i', 'd'},
+		{0x81, 0xc4, 0x03, 'i', 'd', 'A', 0x80},
+		{0x81, 0xa3, 'i', 'd', 'A', 0x81, 0xa5, 't', 'i', 'c', 'k', 's', 0xff},
+		{0x82, 0xa1, 'A', 0x80, 0xa1, 'A', 0x80},
+		{0x81, 0xa1, 'A', 0x80, 0x00},
+		{0xdf, 0xff, 0xff, 0xff, 0xff},
+	} {
+		vc, err := msgpack.Unmarshal(data)
+		c.Assert(err, ErrorMatches, "bad vclock msgpack", Commentf("%x", data))
+		c.Assert(vc, IsNil)
+	}
+}
+
+func (S) TestUnmarshalSizeLimit(c *C) {
+	data := make([]byte, vclock.MaxSize+1)
+	data[0] = 0x80
+	_, err := msgpack.Unmarshal(data)
+	c.Assert(err, ErrorMatches, "bad vclock msgpack")
+}
+
+func (S) TestClock(c *C) {
+	vc := vclock.New()
+	vc.Update("idA", 1)
+	data, err := msgpack.Clock{vc}.MarshalMsgpack()
+	c.Assert(err, IsNil)
+
+	var clock msgpack.Clock
+	err = clock.UnmarshalMsgpack(data)
+	c.Assert(err, IsNil)
+	c.Assert(clock.Compare(vc, vclock.Equal), Equals, true)
+}
+
+func (S) TestNilClock(c *C) {
+	data, err := msgpack.Clock{}.MarshalMsgpack()
+	c.Assert(err, IsNil)
+	c.Assert(data, DeepEquals, []byte{0xc0})
+
+	clock := msgpack.Clock{vclock.New()}
+	err = clock.UnmarshalMsgpack(data)
+	c.Assert(err, IsNil)
+	c.Assert(clock.VClock, IsNil)
+}
+
+func (S) TestInvalidUTF8(c *C) {
+	vc := vclock.New()
+	vc.Update("\xff\xfe", 1)
+	data, err := msgpack.Marshal(vc)
+	c.Assert(err, ErrorMatches, "vclock id is not valid UTF-8")
+	c.Assert(data, IsNil)
+
+	vc, err = msgpack.Unmarshal([]byte{0x81, 0xa2, 0xff, 0xfe, 0x80})
+	c.Assert(err, ErrorMatches, "bad vclock msgpack")
+	c.Assert(vc, IsNil)
+}
@@ -0,0 +1,99 @@
+package vclock
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/jbondeson/vclock/internal/protowire"
+)
+
+var errBadProto = errors.New("bad vclock proto")
+
+// MarshalProto returns the Protocol Buffers encoding of vc, according
+// to the VClock message defined in vclock.proto.
+func (vc *VClock) MarshalProto() ([]byte, error) {
+	var result []byte
+	for i := range vc.items {
+		item := &vc.items[i]
+		size := 0
+		if len(item.id) > 0 {
+			size += 1 + uvarintSize(uint64(len(item.id))) + len(item.id)
+		}
+		if item.ticks != 0 {
+			size += 1 + uvarintSize(item.ticks)
+		}
+		if item.lastUpdate != 0 {
+			size += 1 + uvarintSize(item.lastUpdate)
+		}
+		result = append(result, 1<<3|protowire.Bytes)
+		result = binary.AppendUvarint(result, uint64(size))
+		if len(item.id) > 0 {
+			result = append(result, 1<<3|protowire.Bytes)
+			result = binary.AppendUvarint(result, uint64(len(item.id)))
+			result = append(result, item.id...)
+		}
+		if item.ticks != 0 {
+			result = append(result, 2<<3|protowire.Varint)
+			result = binary.AppendUvarint(result, item.ticks)
+		}
+		if item.lastUpdate != 0 {
+			result = append(result, 3<<3|protowire.Varint)
+			result = binary.AppendUvarint(result, item.lastUpdate)
+		}
+	}
+	if result == nil {
+		result = []byte{}
+	}
+	return result, nil
+}
+
+// UnmarshalProto loads into vc the Protocol Buffers encoding of a
+// VClock message as defined in vclock.proto. Unknown fields are skipped.
+// Any entries previously held by vc are discarded.
+func (vc *VClock) UnmarshalProto(data []byte) error {
+	decoded := New()
+	for len(data) > 0 {
+		field, wire, value, rest, ok := protowire.Next(data)
+		if !ok {
+			return errBadProto
+		}
+		data = rest
+		if field != 1 {
+			continue
+		}
+		if wire != protowire.Bytes {
+			return errBadProto
+		}
+		var item itemType
+		for len(value) > 0 {
+			field, wire, fieldValue, rest, ok := protowire.Next(value)
+			if !ok {
+				return errBadProto
+			}
+			value = rest
+			switch {
+			case field == 1 && wire == protowire.Bytes:
+				item.id = string(fieldValue)
+			case field == 2 && wire == protowire.Varint:
+				item.ticks, _ = binary.Uvarint(fieldValue)
+			case field == 3 && wire == protowire.Varint:
+				item.lastUpdate, _ = binary.Uvarint(fieldValue)
+			case field <= 3:
+				return errBadProto
+			}
+		}
+		decoded.updateItem(item.id, item.ticks, item.lastUpdate)
+	}
+	*vc = *decoded
+	return nil
+}
+
+// uvarintSize returns the number of bytes used when value is packed
+// via binary.AppendUvarint.
+func uvarintSize(value uint64) int {
+	size := 1
+	for value >= 0x80 {
+		value >>= 7
+		size++
+	}
+	return size
+}
@@ -0,0 +1,86 @@
+package vclock_test
+
+import (
+	"github.com/jbondeson/vclock"
+	. "launchpad.net/gocheck"
+)
+
+type protoTest struct {
+	summary string
+	items   []truncItem
+	golden  []byte
+}
+
+var protoTests = []protoTest{
+	{
+		"Empty clock",
+		[]truncItem{},
+		[]byte{},
+	},
+	{
+		"Without time",
+		[]truncItem{{"idA", 1, 0}},
+		[]byte{0x0a, 0x07, 0x0a, 0x03, 'i', 'd', 'A', 0x10, 0x01},
+	},
+	{
+		"With time",
+		[]truncItem{{"idA", 2, 17}},
+		[]byte{0x0a, 0x09, 0x0a, 0x03, 'i', 'd', 'A', 0x10, 0x02, 0x18, 0x11},
+	},
+	{
+		"Multi-byte varints and several entries",
+		[]truncItem{{"idA", 1, 300}, {"idB", 150, 0}},
+		[]byte{
+			0x0a, 0x0a, 0x0a, 0x03, 'i', 'd', 'A', 0x10, 0x01, 0x18, 0xac, 0x02,
+			0x0a, 0x08, 0x0a, 0x03, 'i', 'd', 'B', 0x10, 0x96, 0x01,
+		},
+	},
+}
+
+func (S) TestProtoGolden(c *C) {
+	for _, test := range protoTests {
+		vc := newTestClock(test.items)
+		data, err := vc.MarshalProto()
+		c.Assert(err, IsNil)
+		c.Assert(data, DeepEquals, test.golden, Commentf(test.summary))
+
+		decoded := vclock.New()
+		decoded.Update("idC", 1)
+		err = decoded.UnmarshalProto(test.golden)
+		c.Assert(err, IsNil, Commentf(test.summary))
+		c.Assert(decoded.Bytes(), DeepEquals, vc.Bytes(), Commentf(test.summary))
+	}
+}
+
+func (S) TestUnmarshalProtoUnknownFields(c *C) {
+	data := []byte{
+		// Unknown fixed32 field 2 in VClock.
+		0x15, 1, 2, 3, 4,
+		// Entry with fields out of order, and an unknown fixed64 field 4.
+		0x0a, 0x12, 0x18, 0x11, 0x21, 1, 2, 3, 4, 5, 6, 7, 8, 0x10, 0x02, 0x0a, 0x03, 'i', 'd', 'A',
+		// Unknown string field 3 in VClock.
+		0x1a, 0x01, 'X',
+	}
+	vc := vclock.New()
+	err := vc.UnmarshalProto(data)
+	c.Assert(err, IsNil)
+	c.Assert(vc.Bytes(), DeepEquals, []byte{1, 2, 17, 3, 'i', 'd', 'A'})
+}
+
+func (S) TestUnmarshalProtoWithBadData(c *C) {
+	for _, data := range [][]byte{
+		{0x0a},
+		{0x0a, 0x05, 0x0a, 0x03, 'i'},
+		{0x08, 0x01},
+		{0x0a, 0x02, 0x10, 0x80},
+		{0x0a, 0x02, 0x12, 0x00},
+		{0x0b},
+		{0x00, 0x00},
+	} {
+		vc := vclock.New()
+		vc.Update("idA", 1)
+		err := vc.UnmarshalProto(data)
+		c.Assert(err, ErrorMatches, "bad vclock proto", Commentf("%v", data))
+		c.Assert(vc.LastUpdate(), Equals, uint64(1))
+	}
+}
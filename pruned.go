@@ -0,0 +1,130 @@
+package vclock
+
+import (
+	"errors"
+)
+
+// Pruned returns whether truncation ever dropped entries from vc, or from
+// any clock merged into it, and if so the pruning watermark: the most
+// recent update time among the dropped entries.
+//
+// The pruning state is kept by PrunedBytes, EncodeBlock and EncodeDelta.
+// It is left out of the Bytes and JSON representations, and of the
+// formats built upon them, so that existing decoders keep reading them.
+// Applications using those may save it alongside the clock, and restore
+// it with SetPruned.
+func (vc *VClock) Pruned() (watermark uint64, pruned bool) {
+	return vc.watermark, vc.pruned
+}
+
+// SetPruned records that entries last updated up to watermark were
+// dropped from vc. The watermark of vc never decreases.
+func (vc *VClock) SetPruned(watermark uint64) {
+	vc.setPruned(watermark)
+}
+
+func (vc *VClock) setPruned(watermark uint64) {
+	vc.pruned = true
+	if watermark > vc.watermark {
+		vc.watermark = watermark
+	}
+}
+
+// CompareCertain is like Compare, but also returns whether the result is
+// certain to hold for the clocks as they were before any truncation.
+//
+// Truncation drops whole entries, so the ticks of ids known to both
+// clocks may be trusted, but an id known to just one of them may have
+// been dropped from the other, and ids dropped from both are not seen at
+// all. An id last updated after the watermark of the other clock is
+// trusted nonetheless: since update times of an id never decrease as its
+// ticks grow, any entry for it dropped from the other clock had fewer
+// ticks. When either clock was pruned, the result is only certain if the
+// trusted entries alone prove that each clock is ahead of the other, or
+// if no missing entry could have changed the result.
+func (vc *VClock) CompareCertain(other *VClock, cond Condition) (match, certain bool) {
+	match = vc.Compare(other, cond)
+	if !vc.pruned && !other.pruned {
+		return match, true
+	}
+	// Whether each clock is known to be ahead of the other somewhere,
+	// and whether it might be due to entries dropped by truncation.
+	var vcAhead, otherAhead bool
+	vcMaybe, otherMaybe := vc.pruned, other.pruned
+	for i := range vc.items {
+		oi, found := other.findItem(vc.items[i].id)
+		switch {
+		case found:
+			if vc.items[i].ticks > other.items[oi].ticks {
+				vcAhead = true
+			} else if vc.items[i].ticks < other.items[oi].ticks {
+				otherAhead = true
+			}
+		case other.pruned && vc.items[i].lastUpdate <= other.watermark:
+			vcMaybe, otherMaybe = true, true
+		default:
+			vcAhead = true
+		}
+	}
+	for i := range other.items {
+		if _, found := vc.findItem(other.items[i].id); !found {
+			if vc.pruned && other.items[i].lastUpdate <= vc.watermark {
+				vcMaybe, otherMaybe = true, true
+			} else {
+				otherAhead = true
+			}
+		}
+	}
+	certain = vcAhead && otherAhead || (vcAhead || !vcMaybe) && (otherAhead || !otherMaybe)
+	return match, certain
+}
+
+// PrunedBytes is like Bytes, but also holds the pruning state of vc.
+// For a pruned clock, the header byte has the 0x2 bit set and is followed
+// by the watermark, so the data may only be loaded by FromPrunedBytes.
+// For other clocks, the data matches Bytes.
+func (vc *VClock) PrunedBytes() []byte {
+	data := vc.Bytes()
+	if !vc.pruned {
+		return data
+	}
+	if len(data) == 0 {
+		data = []byte{0}
+	}
+	result := make([]byte, len(data)+packedIntSize(vc.watermark))
+	result[0] = data[0] | 0x2 // The watermark follows the header.
+	pos := 1 + packInt(vc.watermark, result[1:])
+	copy(result[pos:], data[1:])
+	return result
+}
+
+// FromPrunedBytes decodes a vector clock along with its pruning state
+// from data returned by PrunedBytes. Data returned by Bytes is accepted
+// as well.
+func FromPrunedBytes(data []byte) (vc *VClock, err error) {
+	if len(data) == 0 || data[0]&0x02 == 0 {
+		return FromBytes(data)
+	}
+	watermark, size, ok := unpackInt(data[1:])
+	if !ok {
+		return nil, errors.New("bad vclock watermark")
+	}
+	// Strip the watermark to get back to the Bytes representation.
+	plain := make([]byte, len(data)-size)
+	plain[0] = data[0] &^ 0x02
+	copy(plain[1:], data[1+size:])
+	if vc, err = FromBytes(plain); err != nil {
+		return nil, err
+	}
+	vc.setPruned(watermark)
+	return vc, nil
+}
+
+// prunedSize returns the size of the pruning watermark within the
+// encodings that hold it, which is zero unless the clock was pruned.
+func prunedSize(pruned bool, watermark uint64) int {
+	if !pruned {
+		return 0
+	}
+	return packedIntSize(watermark)
+}
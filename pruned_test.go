@@ -0,0 +1,149 @@
+package vclock_test
+
+import (
+	"encoding/json"
+	"github.com/jbondeson/vclock"
+	. "launchpad.net/gocheck"
+)
+
+func (S) TestPrunedWatermark(c *C) {
+	vc := newTestClock([]truncItem{{"idA", 1, 2}, {"idB", 1, 5}, {"idC", 1, 3}, {"idD", 1, 7}})
+	_, pruned := vc.Pruned()
+	c.Assert(pruned, Equals, false)
+
+	truncated := vc.Truncate(&vclock.Truncation{CutBefore: 2})
+	_, pruned = truncated.Pruned()
+	c.Assert(pruned, Equals, false)
+
+	truncated = vc.Truncate(&vclock.Truncation{CutBefore: 4})
+	watermark, pruned := truncated.Pruned()
+	c.Assert(pruned, Equals, true)
+	c.Assert(watermark, Equals, uint64(3))
+	c.Assert(truncated.Copy(), DeepEquals, truncated)
+
+	// Entries kept after dropped ones must not hide the watermark.
+	watermark, _ = vc.Truncate(vclock.Pin(vclock.LRU{N: 1}, "idA")).Pruned()
+	c.Assert(watermark, Equals, uint64(5))
+
+	truncated.TruncateInPlace(vclock.LRU{N: 1})
+	watermark, _ = truncated.Pruned()
+	c.Assert(watermark, Equals, uint64(5))
+	truncated.SetPruned(4)
+	watermark, _ = truncated.Pruned()
+	c.Assert(watermark, Equals, uint64(5))
+
+	merged := vclock.New()
+	merged.Merge(vc)
+	_, pruned = merged.Pruned()
+	c.Assert(pruned, Equals, false)
+	merged.Merge(truncated)
+	watermark, pruned = merged.Pruned()
+	c.Assert(pruned, Equals, true)
+	c.Assert(watermark, Equals, uint64(5))
+}
+
+func (S) TestPrunedEncodings(c *C) {
+	vc := newTestClock([]truncItem{{"idA", 1, 2}, {"idB", 1, 5}})
+	truncated := vc.Truncate(&vclock.Truncation{CutBefore: 3})
+	c.Assert(truncated.Bytes(), DeepEquals, []byte{1, 1, 5, 3, 'i', 'd', 'B'})
+	c.Assert(truncated.PrunedBytes(), DeepEquals, []byte{3, 2, 1, 5, 3, 'i', 'd', 'B'})
+	empty := vc.Truncate(&vclock.Truncation{CutBefore: 6})
+	c.Assert(empty.Bytes(), DeepEquals, []byte{})
+	c.Assert(empty.PrunedBytes(), DeepEquals, []byte{2, 5})
+	c.Assert(vc.PrunedBytes(), DeepEquals, vc.Bytes())
+
+	watermarks := []uint64{2, 5}
+	for i, pruned := range []*vclock.VClock{truncated, empty} {
+		decoded, err := vclock.FromPrunedBytes(pruned.PrunedBytes())
+		c.Assert(err, IsNil)
+		c.Assert(decoded.Entries(), DeepEquals, pruned.Entries())
+		watermark, ok := decoded.Pruned()
+		c.Assert(ok, Equals, true)
+		c.Assert(watermark, Equals, watermarks[i])
+
+		_, err = vclock.FromBytes(pruned.PrunedBytes())
+		c.Assert(err, ErrorMatches, "bad vclock header")
+		decoded, err = vclock.FromBytes(pruned.Bytes())
+		c.Assert(err, IsNil)
+		_, ok = decoded.Pruned()
+		c.Assert(ok, Equals, false)
+
+		block, err := vclock.OpenBlock(vclock.EncodeBlock([]*vclock.VClock{pruned}))
+		c.Assert(err, IsNil)
+		decoded, err = block.Clock(0)
+		c.Assert(err, IsNil)
+		c.Assert(decoded.PrunedBytes(), DeepEquals, pruned.PrunedBytes())
+
+		decoded, err = vclock.ApplyDelta(vc, vclock.EncodeDelta(vc, pruned))
+		c.Assert(err, IsNil)
+		c.Assert(decoded.PrunedBytes(), DeepEquals, pruned.PrunedBytes())
+		decoded, err = vclock.ApplyDelta(pruned, vclock.EncodeDelta(pruned, vc))
+		c.Assert(err, IsNil)
+		c.Assert(decoded.Compare(vc, vclock.Equal), Equals, true)
+		_, ok = decoded.Pruned()
+		c.Assert(ok, Equals, false)
+	}
+
+	decoded, err := vclock.FromPrunedBytes(vc.Bytes())
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Entries(), DeepEquals, vc.Entries())
+	_, err = vclock.FromPrunedBytes([]byte{2, 0x80})
+	c.Assert(err, ErrorMatches, "bad vclock watermark")
+
+	// The JSON formats are left as they were.
+	empty.SetJSONFormat(vclock.JSONObject)
+	data, err := json.Marshal(empty)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, `{}`)
+}
+
+func prunedCopy(vc *vclock.VClock, watermark uint64) *vclock.VClock {
+	vc = vc.Copy()
+	vc.SetPruned(watermark)
+	return vc
+}
+
+type certainTest struct {
+	summary string
+	a, b    *vclock.VClock
+	cond    vclock.Condition
+	certain bool
+}
+
+var (
+	certainA2B1 = newTestClock([]truncItem{{"idA", 2, 0}, {"idB", 1, 0}})
+	certainA1B2 = newTestClock([]truncItem{{"idA", 1, 0}, {"idB", 2, 0}})
+	certainA1B1 = newTestClock([]truncItem{{"idA", 1, 0}, {"idB", 1, 0}})
+	certainA1   = newTestClock([]truncItem{{"idA", 1, 0}})
+	certainA1C1 = newTestClock([]truncItem{{"idA", 1, 0}, {"idC", 1, 0}})
+
+	certainA1C1At9 = newTestClock([]truncItem{{"idA", 1, 1}, {"idC", 1, 9}})
+	certainA1B1At2 = newTestClock([]truncItem{{"idA", 1, 1}, {"idB", 1, 2}})
+)
+
+var certainTests = []certainTest{
+	{"Not pruned", certainA1, certainA1B1, vclock.Descendant, true},
+	{"Pruned equal", prunedCopy(certainA1B1, 0), certainA1B1, vclock.Equal, false},
+	{"Pruned ancestor", prunedCopy(certainA2B1, 0), certainA1B1, vclock.Ancestor, true},
+	{"Pruned descendant", prunedCopy(certainA1B1, 0), certainA2B1, vclock.Descendant, false},
+	{"Pruned missing id", prunedCopy(certainA1, 0), certainA1B1, vclock.Descendant, false},
+	{"Pruned other missing id", certainA1B1, prunedCopy(certainA1, 0), vclock.Ancestor, false},
+	{"Pruned concurrent on shared ids", prunedCopy(certainA2B1, 0), prunedCopy(certainA1B2, 0), vclock.Concurrent, true},
+	{"Pruned concurrent on missing ids", certainA1C1, prunedCopy(certainA1B1, 0), vclock.Concurrent, false},
+	{"Pruned concurrent on known missing ids", prunedCopy(certainA1C1, 0), certainA1B1, vclock.Concurrent, false},
+	{"Pruned concurrent on shared and missing ids", prunedCopy(certainA2B1, 0), certainA1C1, vclock.Concurrent, false},
+	{"Pruned concurrent with other ahead on missing id", prunedCopy(newTestClock([]truncItem{{"idA", 2, 0}}), 0), certainA1C1, vclock.Concurrent, false},
+	{"Concurrent with other ahead on shared ids", certainA2B1, prunedCopy(newTestClock([]truncItem{{"idA", 1, 0}, {"idB", 2, 0}, {"idC", 1, 0}}), 0), vclock.Concurrent, true},
+	{"Concurrent on id updated after watermark", certainA1C1At9, prunedCopy(certainA1B1At2, 5), vclock.Concurrent, true},
+	{"Concurrent on id updated before watermark", certainA1C1At9, prunedCopy(certainA1B1At2, 9), vclock.Concurrent, false},
+	{"Pruned concurrent on id updated after watermark", prunedCopy(certainA1B1At2, 1), certainA1C1At9, vclock.Concurrent, true},
+}
+
+func (S) TestCompareCertain(c *C) {
+	for _, test := range certainTests {
+		match, certain := test.a.CompareCertain(test.b, test.cond)
+		c.Assert(match, Equals, true, Commentf(test.summary))
+		c.Assert(certain, Equals, test.certain, Commentf(test.summary))
+		c.Assert(match, Equals, test.a.Compare(test.b, test.cond), Commentf(test.summary))
+	}
+}
@@ -0,0 +1,353 @@
+// Package riak converts vector clocks to and from the format used by
+// the vclock module of riak_core.
+//
+// A riak_core vector clock is a list of {Node, {Counter, Timestamp}}
+// tuples, stored and exchanged in the Erlang External Term Format as
+// produced by term_to_binary. Each node maps onto a vclock id, each
+// counter onto its ticks, and each timestamp onto its update time.
+package riak
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"github.com/jbondeson/vclock"
+	"io"
+	"unicode/utf8"
+)
+
+// External Term Format tags.
+const (
+	tagVersion       = 131
+	tagCompressed    = 80
+	tagSmallInteger  = 97
+	tagInteger       = 98
+	tagAtom          = 100
+	tagSmallTuple    = 104
+	tagLargeTuple    = 105
+	tagNil           = 106
+	tagList          = 108
+	tagBinary        = 109
+	tagSmallBig      = 110
+	tagLargeBig      = 111
+	tagSmallAtom     = 115
+	tagAtomUTF8      = 118
+	tagSmallAtomUTF8 = 119
+)
+
+// maxSmallAtomLength is the largest atom length, in bytes, for the small
+// atom encoding, and maxAtomChars the most characters an atom may hold.
+const (
+	maxSmallAtomLength = 0xff
+	maxAtomChars       = 255
+)
+
+// NodeType defines how vclock ids are represented as Erlang terms.
+type NodeType int
+
+const (
+	// Binary represents ids as binaries, as riak_kv does with vnode ids.
+	Binary NodeType = iota
+	// Atom represents ids as atoms, such as Erlang node names. Ids must
+	// then be valid UTF-8, and at most 255 characters long.
+	Atom
+)
+
+var errBadTerm = errors.New("bad riak vclock term")
+
+// Marshal returns the External Term Format encoding of vc as a riak_core
+// vector clock, equivalent to term_to_binary of its list of entries.
+func Marshal(vc *vclock.VClock, nodes NodeType) ([]byte, error) {
+	entries := vc.Entries()
+	out := []byte{tagVersion}
+	if len(entries) > 0 {
+		out = append(out, tagList)
+		out = binary.BigEndian.AppendUint32(out, uint32(len(entries)))
+	}
+	for _, e := range entries {
+		out = append(out, tagSmallTuple, 2)
+		switch nodes {
+		case Binary:
+			out = append(out, tagBinary)
+			out = binary.BigEndian.AppendUint32(out, uint32(len(e.ID)))
+		case Atom:
+			if !utf8.ValidString(e.ID) {
+				return nil, errors.New("riak vclock id is not valid UTF-8")
+			} else if utf8.RuneCountInString(e.ID) > maxAtomChars {
+				return nil, errors.New("riak vclock id too long for an atom")
+			} else if len(e.ID) > maxSmallAtomLength {
+				out = append(out, tagAtomUTF8)
+				out = binary.BigEndian.AppendUint16(out, uint16(len(e.ID)))
+			} else {
+				out = append(out, tagSmallAtomUTF8, byte(len(e.ID)))
+			}
+		default:
+			return nil, errors.New("unknown riak vclock node type")
+		}
+		out = append(out, e.ID...)
+		out = append(out, tagSmallTuple, 2)
+		out = appendInteger(out, e.Ticks)
+		out = appendInteger(out, e.LastUpdate)
+	}
+	return append(out, tagNil), nil
+}
+
+// Unmarshal returns the vector clock represented by data, which must hold
+// a riak_core vector clock in the External Term Format, optionally
+// compressed. Nodes must be binaries or atoms. Inputs larger than
+// vclock.MaxSize, once decompressed, are rejected.
+func Unmarshal(data []byte) (*vclock.VClock, error) {
+	if len(data) < 2 || data[0] != tagVersion {
+		return nil, errBadTerm
+	}
+	data = data[1:]
+	if data[0] == tagCompressed {
+		if len(data) < 5 {
+			return nil, errBadTerm
+		}
+		size := binary.BigEndian.Uint32(data[1:])
+		if size > vclock.MaxSize {
+			return nil, errBadTerm
+		}
+		r, err := zlib.NewReader(bytes.NewReader(data[5:]))
+		if err != nil {
+			return nil, errBadTerm
+		}
+		data = make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, errBadTerm
+		}
+	} else if len(data) > vclock.MaxSize {
+		return nil, errBadTerm
+	}
+	d := decoder{data}
+	entries, ok := d.clock()
+	if !ok || len(d.data) != 0 {
+		return nil, errBadTerm
+	}
+	return vclock.FromEntries(entries), nil
+}
+
+// MarshalHeader returns vc encoded as riak_kv does in the X-Riak-Vclock
+// HTTP header: the base64 encoding of the deflated term.
+func MarshalHeader(vc *vclock.VClock, nodes NodeType) (string, error) {
+	data, err := Marshal(vc, nodes)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return "", err
+	}
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// UnmarshalHeader returns the vector clock represented by the value of
+// an X-Riak-Vclock HTTP header.
+func UnmarshalHeader(header string) (*vclock.VClock, error) {
+	deflated, err := base64.StdEncoding.DecodeString(header)
+	if err != nil {
+		return nil, errBadTerm
+	}
+	data, err := io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(deflated)), vclock.MaxSize+1))
+	if err != nil || len(data) > vclock.MaxSize {
+		return nil, errBadTerm
+	}
+	return Unmarshal(data)
+}
+
+// appendInteger appends value using the shortest integer representation,
+// as term_to_binary does.
+func appendInteger(out []byte, value uint64) []byte {
+	switch {
+	case value <= 0xff:
+		return append(out, tagSmallInteger, byte(value))
+	case value <= 0x7fffffff:
+		return binary.BigEndian.AppendUint32(append(out, tagInteger), uint32(value))
+	}
+	n := 0
+	for v := value; v > 0; v >>= 8 {
+		n++
+	}
+	out = append(out, tagSmallBig, byte(n), 0)
+	for ; n > 0; n-- {
+		out = append(out, byte(value))
+		value >>= 8
+	}
+	return out
+}
+
+type decoder struct {
+	data []byte
+}
+
+func (d *decoder) take(n uint64) ([]byte, bool) {
+	if n > uint64(len(d.data)) {
+		return nil, false
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b, true
+}
+
+func (d *decoder) tag() (byte, bool) {
+	b, ok := d.take(1)
+	if !ok {
+		return 0, false
+	}
+	return b[0], true
+}
+
+func (d *decoder) uint(size int) (uint64, bool) {
+	b, ok := d.take(uint64(size))
+	if !ok {
+		return 0, false
+	}
+	var value uint64
+	for _, c := range b {
+		value = value<<8 | uint64(c)
+	}
+	return value, true
+}
+
+func (d *decoder) clock() (entries []vclock.Entry, ok bool) {
+	tag, ok := d.tag()
+	if !ok {
+		return nil, false
+	}
+	if tag == tagNil {
+		return nil, true
+	}
+	if tag != tagList {
+		return nil, false
+	}
+	n, ok := d.uint(4)
+	if !ok || n > uint64(len(d.data)) {
+		return nil, false
+	}
+	entries = make([]vclock.Entry, 0, n)
+	seen := make(map[string]bool, n)
+	for ; n > 0; n-- {
+		if !d.tuple() {
+			return nil, false
+		}
+		var e vclock.Entry
+		if e.ID, ok = d.node(); !ok || seen[e.ID] {
+			return nil, false
+		}
+		seen[e.ID] = true
+		if !d.tuple() {
+			return nil, false
+		}
+		if e.Ticks, ok = d.integer(); !ok {
+			return nil, false
+		}
+		if e.LastUpdate, ok = d.integer(); !ok {
+			return nil, false
+		}
+		entries = append(entries, e)
+	}
+	tag, ok = d.tag()
+	return entries, ok && tag == tagNil
+}
+
+// tuple consumes the header of a 2-tuple.
+func (d *decoder) tuple() bool {
+	tag, ok := d.tag()
+	if !ok {
+		return false
+	}
+	var arity uint64
+	switch tag {
+	case tagSmallTuple:
+		arity, ok = d.uint(1)
+	case tagLargeTuple:
+		arity, ok = d.uint(4)
+	default:
+		return false
+	}
+	return ok && arity == 2
+}
+
+func (d *decoder) node() (string, bool) {
+	tag, ok := d.tag()
+	if !ok {
+		return "", false
+	}
+	var size uint64
+	switch tag {
+	case tagBinary:
+		size, ok = d.uint(4)
+	case tagAtom, tagAtomUTF8:
+		size, ok = d.uint(2)
+	case tagSmallAtom, tagSmallAtomUTF8:
+		size, ok = d.uint(1)
+	default:
+		return "", false
+	}
+	if !ok {
+		return "", false
+	}
+	b, ok := d.take(size)
+	if !ok {
+		return "", false
+	}
+	if tag == tagAtom || tag == tagSmallAtom {
+		// Latin-1 atoms.
+		runes := make([]rune, len(b))
+		for i, c := range b {
+			runes[i] = rune(c)
+		}
+		return string(runes), true
+	}
+	return string(b), true
+}
+
+// integer consumes a non-negative integer fitting in 64 bits.
+func (d *decoder) integer() (uint64, bool) {
+	tag, ok := d.tag()
+	if !ok {
+		return 0, false
+	}
+	var n uint64
+	switch tag {
+	case tagSmallInteger:
+		return d.uint(1)
+	case tagInteger:
+		value, ok := d.uint(4)
+		return value, ok && int32(value) >= 0
+	case tagSmallBig:
+		n, ok = d.uint(1)
+	case tagLargeBig:
+		n, ok = d.uint(4)
+	default:
+		return 0, false
+	}
+	if !ok {
+		return 0, false
+	}
+	sign, ok := d.tag()
+	if !ok || sign != 0 {
+		return 0, false
+	}
+	digits, ok := d.take(n)
+	if !ok {
+		return 0, false
+	}
+	var value uint64
+	for i := len(digits) - 1; i >= 0; i-- {
+		if value>>56 != 0 {
+			return 0, false
+		}
+		value = value<<8 | uint64(digits[i])
+	}
+	return value, true
+}
@@ -0,0 +1,166 @@
+package riak_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"github.com/jbondeson/vclock"
+	"github.com/jbondeson/vclock/riak"
+	. "launchpad.net/gocheck"
+	"strings"
+	"testing"
+)
+
+func TestAll(c *testing.T) {
+	TestingT(c)
+}
+
+type S struct{}
+
+var _ = Suite(&S{})
+
+type goldenTest struct {
+	summary string
+	nodes   riak.NodeType
+	entries []vclock.Entry
+	golden  []byte
+}
+
+// Golden outputs of term_to_binary for riak_core vector clocks.
+var goldenTests = []goldenTest{
+	{
+		// term_to_binary([]).
+		"Empty clock",
+		riak.Binary,
+		nil,
+		[]byte{131, 106},
+	},
+	{
+		// term_to_binary([{<<"a">>, {1, 63871234567}}]).
+		"Binary node with gregorian seconds timestamp",
+		riak.Binary,
+		[]vclock.Entry{{ID: "a", Ticks: 1, LastUpdate: 63871234567}},
+		[]byte{
+			131, 108, 0, 0, 0, 1,
+			104, 2, 109, 0, 0, 0, 1, 'a',
+			104, 2, 97, 1, 110, 5, 0, 7, 178, 5, 223, 14,
+			106,
+		},
+	},
+	{
+		// term_to_binary([{'n1@h', {300, 255}}, {'n2@h', {2147483648, 0}}]).
+		"Atom nodes with assorted integer sizes",
+		riak.Atom,
+		[]vclock.Entry{{ID: "n1@h", Ticks: 300, LastUpdate: 255}, {ID: "n2@h", Ticks: 1 << 31}},
+		[]byte{
+			131, 108, 0, 0, 0, 2,
+			104, 2, 119, 4, 'n', '1', '@', 'h',
+			104, 2, 98, 0, 0, 1, 44, 97, 255,
+			104, 2, 119, 4, 'n', '2', '@', 'h',
+			104, 2, 110, 4, 0, 0, 0, 0, 128, 97, 0,
+			106,
+		},
+	},
+}
+
+func (S) TestGolden(c *C) {
+	for _, test := range goldenTests {
+		vc := vclock.FromEntries(test.entries)
+		data, err := riak.Marshal(vc, test.nodes)
+		c.Assert(err, IsNil)
+		c.Assert(data, DeepEquals, test.golden, Commentf(test.summary))
+
+		decoded, err := riak.Unmarshal(test.golden)
+		c.Assert(err, IsNil, Commentf(test.summary))
+		c.Assert(decoded.Entries(), DeepEquals, vc.Entries(), Commentf(test.summary))
+	}
+}
+
+func (S) TestMarshalLongAtoms(c *C) {
+	// 255 characters take 510 bytes, beyond the small atom encoding.
+	id := strings.Repeat("é", 255)
+	data, err := riak.Marshal(vclock.FromEntries([]vclock.Entry{{ID: id, Ticks: 1}}), riak.Atom)
+	c.Assert(err, IsNil)
+	c.Assert(data[:11], DeepEquals, []byte{131, 108, 0, 0, 0, 1, 104, 2, 118, 1, 254})
+	decoded, err := riak.Unmarshal(data)
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Entries(), DeepEquals, []vclock.Entry{{ID: id, Ticks: 1}})
+}
+
+func (S) TestMarshalBadAtoms(c *C) {
+	for _, id := range []string{"\xff\xfe", strings.Repeat("a", 256)} {
+		_, err := riak.Marshal(vclock.FromEntries([]vclock.Entry{{ID: id, Ticks: 1}}), riak.Atom)
+		c.Assert(err, NotNil, Commentf("%q", id))
+		_, err = riak.Marshal(vclock.FromEntries([]vclock.Entry{{ID: id, Ticks: 1}}), riak.Binary)
+		c.Assert(err, IsNil, Commentf("%q", id))
+	}
+}
+
+func (S) TestUnmarshalLegacyTerms(c *C) {
+	// Atoms encoded by releases prior to OTP 26, a large tuple, and
+	// a large big integer.
+	data := []byte{
+		131, 108, 0, 0, 0, 2,
+		104, 2, 100, 0, 2, 'n', 0xe9,
+		105, 0, 0, 0, 2, 97, 1, 111, 0, 0, 0, 2, 0, 1, 1,
+		104, 2, 115, 2, 'n', '2',
+		104, 2, 97, 2, 97, 0,
+		106,
+	}
+	vc, err := riak.Unmarshal(data)
+	c.Assert(err, IsNil)
+	c.Assert(vc.Entries(), DeepEquals, []vclock.Entry{
+		{ID: "né", Ticks: 1, LastUpdate: 257},
+		{ID: "n2", Ticks: 2},
+	})
+}
+
+func (S) TestUnmarshalCompressed(c *C) {
+	golden := goldenTests[2].golden
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write(golden[1:])
+	w.Close()
+	data := []byte{131, 80}
+	data = binary.BigEndian.AppendUint32(data, uint32(len(golden)-1))
+	data = append(data, buf.Bytes()...)
+
+	vc, err := riak.Unmarshal(data)
+	c.Assert(err, IsNil)
+	c.Assert(vc.Entries(), DeepEquals, goldenTests[2].entries)
+}
+
+func (S) TestHeader(c *C) {
+	vc := vclock.FromEntries(goldenTests[2].entries)
+	header, err := riak.MarshalHeader(vc, riak.Binary)
+	c.Assert(err, IsNil)
+	decoded, err := riak.UnmarshalHeader(header)
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Entries(), DeepEquals, vc.Entries())
+
+	_, err = riak.UnmarshalHeader("!")
+	c.Assert(err, ErrorMatches, "bad riak vclock term")
+}
+
+func (S) TestUnmarshalWithBadData(c *C) {
+	for _, data := range [][]byte{
+		{},
+		{131},
+		{130, 106},
+		{131, 106, 106},
+		{131, 108, 0, 0, 0, 1, 106},
+		{131, 108, 0, 0, 0, 1, 104, 3, 109, 0, 0, 0, 0, 104, 2, 97, 1, 97, 1, 106},
+		{131, 108, 0, 0, 0, 1, 104, 2, 97, 1, 104, 2, 97, 1, 97, 1, 106},
+		{131, 108, 0, 0, 0, 1, 104, 2, 109, 0, 0, 0, 0, 104, 2, 98, 255, 255, 255, 255, 97, 1, 106},
+		{131, 108, 0, 0, 0, 1, 104, 2, 109, 0, 0, 0, 0, 104, 2, 110, 1, 1, 1, 97, 1, 106},
+		{131, 108, 0, 0, 0, 1, 104, 2, 109, 0, 0, 0, 0, 104, 2, 110, 9, 0, 1, 1, 1, 1, 1, 1, 1, 1, 1, 97, 1, 106},
+		{131, 108, 0, 0, 0, 1, 104, 2, 109, 0, 0, 0, 0, 104, 2, 97, 1, 97, 1, 107},
+		{131, 108, 0, 0, 0, 2, 104, 2, 109, 0, 0, 0, 0, 104, 2, 97, 1, 97, 1, 104, 2, 109, 0, 0, 0, 0, 104, 2, 97, 1, 97, 1, 106},
+		{131, 80, 255, 255, 255, 255, 0},
+		{131, 80, 0, 0, 0, 10, 1, 2, 3},
+	} {
+		vc, err := riak.Unmarshal(data)
+		c.Assert(err, ErrorMatches, "bad riak vclock term", Commentf("%v", data))
+		c.Assert(vc, IsNil)
+	}
+}
@@ -0,0 +1,146 @@
+package vclock
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"sync"
+)
+
+// SealedTokenCodec converts vector clocks to and from opaque tokens which,
+// unlike those of TokenCodec, do not reveal the ids within the clock.
+//
+// Tokens are encrypted and authenticated with AES-GCM, and bound to a
+// resource key provided by the caller, such as the key of the object the
+// clock versions, so that a token issued for one resource is rejected when
+// presented for another. Keys may be rotated as with TokenCodec.
+//
+// A SealedTokenCodec is safe for concurrent use.
+type SealedTokenCodec struct {
+	mu      sync.RWMutex
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// NewSealedTokenCodec returns a codec sealing tokens with key, identified
+// within tokens by keyID. The key must be 16, 24, or 32 bytes long, to
+// select AES-128, AES-192, or AES-256.
+func NewSealedTokenCodec(keyID string, key []byte) (*SealedTokenCodec, error) {
+	tc := &SealedTokenCodec{keys: make(map[string]cipher.AEAD)}
+	if err := tc.Rotate(keyID, key); err != nil {
+		return nil, err
+	}
+	return tc, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// AddKey makes tc accept tokens sealed with key under keyID, without
+// using it to seal new tokens.
+func (tc *SealedTokenCodec) AddKey(keyID string, key []byte) error {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	tc.mu.Lock()
+	tc.keys[keyID] = aead
+	tc.mu.Unlock()
+	return nil
+}
+
+// Rotate makes key, identified by keyID, the one used to seal new tokens.
+// Tokens sealed with previous keys remain accepted until they are removed.
+func (tc *SealedTokenCodec) Rotate(keyID string, key []byte) error {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	tc.mu.Lock()
+	tc.keys[keyID] = aead
+	tc.current = keyID
+	tc.mu.Unlock()
+	return nil
+}
+
+// RemoveKey stops tc from accepting tokens sealed under keyID.
+// The current key cannot be removed.
+func (tc *SealedTokenCodec) RemoveKey(keyID string) {
+	tc.mu.Lock()
+	if keyID != tc.current {
+		delete(tc.keys, keyID)
+	}
+	tc.mu.Unlock()
+}
+
+// Encode returns a sealed token holding vc, valid only for resource.
+//
+// The format of the decoded token is:
+//
+//	[ version byte | key id len | key id | nonce | sealed clock bytes ]
+//
+// where the version byte and key id are authenticated along with the
+// resource, and the token itself is its unpadded base64 URL encoding.
+func (tc *SealedTokenCodec) Encode(vc *VClock, resource []byte) (string, error) {
+	tc.mu.RLock()
+	keyID, aead := tc.current, tc.keys[tc.current]
+	tc.mu.RUnlock()
+
+	token := tokenHeader(sealedTokenVersion, keyID, aead.NonceSize()+vc.computeBytesSize()+aead.Overhead())
+	header := len(token)
+	token = token[:header+aead.NonceSize()]
+	if _, err := rand.Read(token[header:]); err != nil {
+		return "", err
+	}
+	token = aead.Seal(token, token[header:], vc.Bytes(), sealedTokenData(token[:header], resource))
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// Decode returns the vector clock held by token, which must have been
+// generated by Encode for the same resource, with a key known to tc.
+// Rejected tokens are reported with a *TokenError.
+func (tc *SealedTokenCodec) Decode(token string, resource []byte) (*VClock, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, &TokenError{Kind: TokenMalformed}
+	}
+	// The shortest nonce and tag used by AES-GCM are 12 bytes each.
+	keyID, rest, ok := splitToken(data, sealedTokenVersion, 24)
+	if !ok {
+		return nil, &TokenError{Kind: TokenMalformed}
+	}
+	tc.mu.RLock()
+	aead, found := tc.keys[keyID]
+	tc.mu.RUnlock()
+	if !found {
+		return nil, &TokenError{Kind: TokenUnknownKey, KeyID: keyID}
+	}
+	if len(rest) < aead.NonceSize()+aead.Overhead() {
+		return nil, &TokenError{Kind: TokenMalformed, KeyID: keyID}
+	}
+	header := data[:len(data)-len(rest)]
+	nonce, sealed := rest[:aead.NonceSize()], rest[aead.NonceSize():]
+	payload, err := aead.Open(nil, nonce, sealed, sealedTokenData(header, resource))
+	if err != nil {
+		return nil, &TokenError{Kind: TokenBadSignature, KeyID: keyID}
+	}
+	vc, err := FromBytes(payload)
+	if err != nil {
+		return nil, &TokenError{Kind: TokenMalformed, KeyID: keyID}
+	}
+	return vc, nil
+}
+
+// sealedTokenData returns the associated data authenticated along with
+// a sealed token. The token header is length-prefixed, so no two pairs
+// of header and resource produce the same data.
+func sealedTokenData(header, resource []byte) []byte {
+	data := make([]byte, 0, len(header)+len(resource))
+	return append(append(data, header...), resource...)
+}
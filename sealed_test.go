@@ -0,0 +1,99 @@
+package vclock_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"github.com/jbondeson/vclock"
+	. "launchpad.net/gocheck"
+	"strings"
+)
+
+var (
+	sealKey1 = bytes.Repeat([]byte{1}, 32)
+	sealKey2 = bytes.Repeat([]byte{2}, 16)
+)
+
+func (S) TestSealedTokenRoundTrip(c *C) {
+	tc, err := vclock.NewSealedTokenCodec("k1", sealKey1)
+	c.Assert(err, IsNil)
+	vc := vclock.New()
+	vc.Update("db-internal-17.example", 5)
+
+	token, err := tc.Encode(vc, []byte("bucket/key"))
+	c.Assert(err, IsNil)
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	c.Assert(err, IsNil)
+	c.Assert(bytes.Contains(data, []byte("internal")), Equals, false)
+
+	decoded, err := tc.Decode(token, []byte("bucket/key"))
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Bytes(), DeepEquals, vc.Bytes())
+
+	// Tokens for the same clock differ, as nonces are random.
+	again, err := tc.Encode(vc, []byte("bucket/key"))
+	c.Assert(err, IsNil)
+	c.Assert(again, Not(Equals), token)
+}
+
+func (S) TestSealedTokenResourceBinding(c *C) {
+	tc, err := vclock.NewSealedTokenCodec("k1", sealKey1)
+	c.Assert(err, IsNil)
+	token, err := tc.Encode(tokenTestClock(), []byte("bucket/key1"))
+	c.Assert(err, IsNil)
+
+	vc, err := tc.Decode(token, []byte("bucket/key2"))
+	c.Assert(err, ErrorMatches, "vclock token signature mismatch")
+	c.Assert(tokenErrorKind(err), Equals, vclock.TokenBadSignature)
+	c.Assert(vc, IsNil)
+}
+
+func (S) TestSealedTokenKeyRotation(c *C) {
+	tc, err := vclock.NewSealedTokenCodec("k1", sealKey1)
+	c.Assert(err, IsNil)
+	old, err := tc.Encode(tokenTestClock(), nil)
+	c.Assert(err, IsNil)
+	c.Assert(tc.Rotate("k2", sealKey2), IsNil)
+	current, err := tc.Encode(tokenTestClock(), nil)
+	c.Assert(err, IsNil)
+
+	for _, token := range []string{old, current} {
+		_, err := tc.Decode(token, nil)
+		c.Assert(err, IsNil)
+	}
+	tc.RemoveKey("k1")
+	_, err = tc.Decode(old, nil)
+	c.Assert(tokenErrorKind(err), Equals, vclock.TokenUnknownKey)
+
+	c.Assert(tc.AddKey("k3", []byte("short")), ErrorMatches, ".*invalid key size 5")
+	_, err = vclock.NewSealedTokenCodec("k1", []byte("short"))
+	c.Assert(err, ErrorMatches, ".*invalid key size 5")
+}
+
+func (S) TestSealedTokenTampered(c *C) {
+	tc, err := vclock.NewSealedTokenCodec("k1", sealKey1)
+	c.Assert(err, IsNil)
+	token, err := tc.Encode(tokenTestClock(), []byte("key"))
+	c.Assert(err, IsNil)
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	c.Assert(err, IsNil)
+
+	for i := range data {
+		tampered := append([]byte(nil), data...)
+		tampered[i] ^= 0x01
+		vc, err := tc.Decode(base64.RawURLEncoding.EncodeToString(tampered), []byte("key"))
+		c.Assert(err, NotNil, Commentf("byte %d", i))
+		c.Assert(vc, IsNil)
+		c.Assert(tokenErrorKind(err), Not(Equals), vclock.TokenErrorKind(0))
+	}
+	for i := 0; i < len(token); i++ {
+		_, err := tc.Decode(token[:i], []byte("key"))
+		c.Assert(tokenErrorKind(err), Not(Equals), vclock.TokenErrorKind(0), Commentf("length %d", i))
+	}
+
+	// Signed tokens are not accepted as sealed ones.
+	signed := tokenTestCodec(c, "k1", sealKey1).Encode(tokenTestClock())
+	_, err = tc.Decode(signed, []byte("key"))
+	c.Assert(tokenErrorKind(err), Equals, vclock.TokenMalformed)
+	_, err = tc.Decode(strings.Repeat("A", 40), []byte("key"))
+	c.Assert(tokenErrorKind(err), Equals, vclock.TokenMalformed)
+}
@@ -0,0 +1,108 @@
+package vclock
+
+import (
+	"slices"
+	"strings"
+)
+
+// SkewOptions defines the limits used by SkewReport.
+type SkewOptions struct {
+	// Tolerance is how far ahead of the local time an update time may be
+	// before its actor is reported as ahead.
+	Tolerance uint64
+	// MaxLag is how far behind the median update time of its peers the
+	// update time of an actor may be before the actor is reported as
+	// behind. If zero, no actors are reported as behind.
+	MaxLag uint64
+}
+
+// SkewKind classifies the inconsistencies found by SkewReport.
+type SkewKind int
+
+const (
+	// SkewAhead reports an actor with an update time in the future.
+	SkewAhead SkewKind = iota + 1
+	// SkewBehind reports an actor whose update time is far behind
+	// those of its peers. Besides a slow clock, that may also
+	// denote an actor that stopped updating the clocks.
+	SkewBehind
+)
+
+func (k SkewKind) String() string {
+	switch k {
+	case SkewAhead:
+		return "ahead"
+	case SkewBehind:
+		return "behind"
+	}
+	return "unknown"
+}
+
+// Skew describes an actor whose update times look inconsistent.
+type Skew struct {
+	ID   string
+	Kind SkewKind
+	// LastUpdate is the most recent update time of the actor across
+	// all the inspected clocks.
+	LastUpdate uint64
+	// Offset is how far LastUpdate is ahead of the local time, or
+	// behind the median update time of the peers of the actor.
+	Offset uint64
+}
+
+// SkewReport inspects the update times recorded for each actor in the
+// provided clocks, all using the same unit as now, and reports the actors
+// which seem to have a wrong wall clock, ordered by id. Since update times
+// are supplied by the actors themselves, a bad clock may otherwise skew
+// truncation by time, either protecting entries from it or getting them
+// dropped too early.
+//
+// Actors with an update time later than now plus opts.Tolerance are
+// reported as ahead. The remaining actors are compared with the median
+// update time of their peers, and reported as behind if lagging more
+// than opts.MaxLag. Entries without an update time are ignored.
+func SkewReport(now uint64, opts SkewOptions, clocks ...*VClock) []Skew {
+	latest := make(map[string]uint64)
+	for _, vc := range clocks {
+		for i := range vc.items {
+			item := &vc.items[i]
+			if item.lastUpdate > latest[item.id] {
+				latest[item.id] = item.lastUpdate
+			}
+		}
+	}
+
+	var report []Skew
+	var times []uint64
+	for id, lastUpdate := range latest {
+		if lastUpdate > now && lastUpdate-now > opts.Tolerance {
+			report = append(report, Skew{id, SkewAhead, lastUpdate, lastUpdate - now})
+		} else {
+			times = append(times, lastUpdate)
+		}
+	}
+
+	if opts.MaxLag > 0 && len(times) > 1 {
+		slices.Sort(times)
+		// The peers of an actor are all actors but itself, so the median
+		// of peers skips the time of the actor from the sorted times.
+		peerMedian := (len(times) - 1) / 2 // Index within the times of peers.
+		for id, lastUpdate := range latest {
+			k, found := slices.BinarySearch(times, lastUpdate)
+			if !found {
+				continue // Reported as ahead.
+			}
+			median := times[peerMedian]
+			if peerMedian >= k {
+				// Skip the time of the actor.
+				median = times[peerMedian+1]
+			}
+			if median > lastUpdate && median-lastUpdate > opts.MaxLag {
+				report = append(report, Skew{id, SkewBehind, lastUpdate, median - lastUpdate})
+			}
+		}
+	}
+
+	slices.SortFunc(report, func(a, b Skew) int { return strings.Compare(a.ID, b.ID) })
+	return report
+}
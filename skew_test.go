@@ -0,0 +1,34 @@
+package vclock_test
+
+import (
+	"github.com/jbondeson/vclock"
+	. "launchpad.net/gocheck"
+)
+
+func (S) TestSkewReport(c *C) {
+	vc1 := newTestClock([]truncItem{{"idA", 1, 1000}, {"idB", 1, 990}, {"idF", 1, 1300}})
+	vc2 := newTestClock([]truncItem{{"idA", 2, 1010}, {"idC", 1, 400}, {"idD", 1, 1030}, {"idE", 1, 0}})
+	opts := vclock.SkewOptions{Tolerance: 60, MaxLag: 300}
+	c.Assert(vclock.SkewReport(1000, opts, vc1, vc2), DeepEquals, []vclock.Skew{
+		{ID: "idC", Kind: vclock.SkewBehind, LastUpdate: 400, Offset: 610},
+		{ID: "idF", Kind: vclock.SkewAhead, LastUpdate: 1300, Offset: 300},
+	})
+
+	// Without MaxLag only actors ahead are reported.
+	report := vclock.SkewReport(1000, vclock.SkewOptions{}, vc1, vc2)
+	c.Assert(report, HasLen, 3)
+	for i, id := range []string{"idA", "idD", "idF"} {
+		c.Assert(report[i].ID, Equals, id)
+		c.Assert(report[i].Kind.String(), Equals, "ahead")
+	}
+}
+
+func (S) TestSkewReportPeers(c *C) {
+	vc := newTestClock([]truncItem{{"idA", 1, 100}, {"idB", 1, 10}})
+	// The median of the peers of idA is idB's time, and vice versa.
+	c.Assert(vclock.SkewReport(100, vclock.SkewOptions{MaxLag: 50}, vc), DeepEquals, []vclock.Skew{
+		{ID: "idB", Kind: vclock.SkewBehind, LastUpdate: 10, Offset: 90},
+	})
+	c.Assert(vclock.SkewReport(100, vclock.SkewOptions{MaxLag: 50}, newTestClock([]truncItem{{"idA", 1, 10}})), HasLen, 0)
+	c.Assert(vclock.SkewReport(100, vclock.SkewOptions{MaxLag: 50}), HasLen, 0)
+}
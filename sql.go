@@ -0,0 +1,69 @@
+package vclock
+
+import (
+	"database/sql/driver"
+	"fmt"
+)
+
+// database/sql/driver.Valuer interface
+//
+// The clock is stored in its Bytes representation, which suits binary
+// columns such as BYTEA or BLOB. Use JSONColumn to store JSON text
+// instead. A nil clock is stored as NULL.
+func (vc *VClock) Value() (driver.Value, error) {
+	if vc == nil {
+		return nil, nil
+	}
+	return vc.Bytes(), nil
+}
+
+// JSONColumn wraps a clock to store it as JSON text in the JSONObject
+// format, which suits JSON or text columns, as in:
+//
+//	db.Exec("UPDATE docs SET version = ? WHERE id = ?", vclock.JSONColumn{vc}, id)
+//
+// Scanning a JSONColumn loads the wrapped clock as VClock.Scan does.
+type JSONColumn struct {
+	*VClock
+}
+
+// database/sql/driver.Valuer interface
+func (c JSONColumn) Value() (driver.Value, error) {
+	if c.VClock == nil {
+		return nil, nil
+	}
+	data, err := c.marshalJSON(JSONObject)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// database/sql.Scanner interface
+//
+// Both the binary and the JSON forms are accepted, and a NULL column
+// loads an empty clock. Any entries previously held by vc are discarded.
+func (vc *VClock) Scan(src interface{}) error {
+	var data []byte
+	switch src := src.(type) {
+	case nil:
+		*vc = VClock{}
+		return nil
+	case []byte:
+		data = src
+	case string:
+		data = []byte(src)
+	default:
+		return fmt.Errorf("cannot scan %T into vclock", src)
+	}
+	if len(data) > 0 && (data[0] == '{' || data[0] == '"') {
+		// The binary header byte is never a JSON delimiter.
+		return vc.UnmarshalJSON(data)
+	}
+	decoded := New()
+	if err := decoded.fromBytes(data); err != nil {
+		return err
+	}
+	*vc = *decoded
+	return nil
+}
@@ -0,0 +1,143 @@
+package vclock_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/jbondeson/vclock"
+	"io"
+	. "launchpad.net/gocheck"
+)
+
+// stubDriver is an in-memory database/sql driver understanding just two
+// statements: "SET" stores its second argument under the key given as the
+// first one, and "GET" returns the value stored under the given key.
+type stubDriver struct {
+	values map[string]driver.Value
+}
+
+type stubConn struct{ d *stubDriver }
+type stubStmt struct {
+	d     *stubDriver
+	query string
+}
+type stubRows struct{ values []driver.Value }
+
+func (d *stubDriver) Open(name string) (driver.Conn, error) { return stubConn{d}, nil }
+
+func (c stubConn) Prepare(query string) (driver.Stmt, error) { return stubStmt{c.d, query}, nil }
+func (c stubConn) Close() error                              { return nil }
+func (c stubConn) Begin() (driver.Tx, error)                 { return nil, errors.New("no transactions") }
+
+func (s stubStmt) Close() error  { return nil }
+func (s stubStmt) NumInput() int { return -1 }
+
+func (s stubStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if s.query != "SET" || len(args) != 2 {
+		return nil, errors.New("bad exec: " + s.query)
+	}
+	s.d.values[args[0].(string)] = args[1]
+	return driver.RowsAffected(1), nil
+}
+
+func (s stubStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if s.query != "GET" || len(args) != 1 {
+		return nil, errors.New("bad query: " + s.query)
+	}
+	return &stubRows{[]driver.Value{s.d.values[args[0].(string)]}}, nil
+}
+
+func (r *stubRows) Columns() []string { return []string{"version"} }
+func (r *stubRows) Close() error      { return nil }
+
+func (r *stubRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	dest[0], r.values = r.values[0], r.values[1:]
+	return nil
+}
+
+var stub = &stubDriver{make(map[string]driver.Value)}
+
+func init() {
+	sql.Register("vclockstub", stub)
+}
+
+func (s *S) TestSQLRoundTrip(c *C) {
+	db, err := sql.Open("vclockstub", "")
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	vc1 := vclock.New()
+	vc1.Update("idA", 3)
+	vc1.Update("idB", 5)
+
+	_, err = db.Exec("SET", "binary", vc1)
+	c.Assert(err, IsNil)
+	c.Assert(stub.values["binary"], DeepEquals, vc1.Bytes())
+
+	vc2 := vclock.New()
+	err = db.QueryRow("GET", "binary").Scan(vc2)
+	c.Assert(err, IsNil)
+	c.Assert(vc2.Bytes(), DeepEquals, vc1.Bytes())
+
+	_, err = db.Exec("SET", "json", vclock.JSONColumn{vc1})
+	c.Assert(err, IsNil)
+	c.Assert(stub.values["json"], Equals, `{"idA":{"ticks":1,"lastUpdate":3},"idB":{"ticks":1,"lastUpdate":5}}`)
+
+	vc3 := vclock.New()
+	err = db.QueryRow("GET", "json").Scan(vclock.JSONColumn{vc3})
+	c.Assert(err, IsNil)
+	c.Assert(vc3.Bytes(), DeepEquals, vc1.Bytes())
+
+	// Clocks decoded from JSON are still stored in binary form.
+	_, err = db.Exec("SET", "binary", vc3)
+	c.Assert(err, IsNil)
+	c.Assert(stub.values["binary"], DeepEquals, vc1.Bytes())
+}
+
+func (s *S) TestSQLNull(c *C) {
+	db, err := sql.Open("vclockstub", "")
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	var vc1 *vclock.VClock
+	_, err = db.Exec("SET", "null", vc1)
+	c.Assert(err, IsNil)
+	c.Assert(stub.values["null"], IsNil)
+	stub.values["jsonnull"] = "{}"
+	_, err = db.Exec("SET", "jsonnull", vclock.JSONColumn{})
+	c.Assert(err, IsNil)
+	c.Assert(stub.values["jsonnull"], IsNil)
+
+	vc2 := vclock.New()
+	vc2.Update("idA", 1)
+	err = db.QueryRow("GET", "null").Scan(vc2)
+	c.Assert(err, IsNil)
+	c.Assert(vc2.Compare(vclock.New(), vclock.Equal), Equals, true)
+}
+
+func (s *S) TestScanResets(c *C) {
+	vc1 := vclock.New()
+	vc1.Update("idA", 1)
+
+	vc2 := vclock.New()
+	vc2.Update("idB", 1)
+	err := vc2.Scan(vc1.Bytes())
+	c.Assert(err, IsNil)
+	c.Assert(vc2.Compare(vc1, vclock.Equal), Equals, true)
+
+	err = vc2.Scan(`{"idC":1}`)
+	c.Assert(err, IsNil)
+	vc3 := vclock.New()
+	vc3.Update("idC", 0)
+	c.Assert(vc2.Compare(vc3, vclock.Equal), Equals, true)
+}
+
+func (s *S) TestScanBadData(c *C) {
+	vc := vclock.New()
+	c.Assert(vc.Scan(42), ErrorMatches, "cannot scan int into vclock")
+	c.Assert(vc.Scan([]byte{128}), ErrorMatches, "bad vclock header")
+	c.Assert(vc.Scan(`{"idA":`), NotNil)
+}
@@ -0,0 +1,182 @@
+package vclock
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MaxSize is the largest serialized clock, in bytes, accepted when
+// reading length-prefixed clocks from a stream, or when decoding clocks
+// from foreign encodings. Larger inputs are reported as errors rather
+// than allocated.
+const MaxSize = 64 << 20
+
+// maxPackedIntSize is the number of bytes packInt takes for the
+// largest uint64.
+const maxPackedIntSize = 10
+
+// An Encoder writes a sequence of length-prefixed vector clocks to an
+// output stream. Each clock is written as its Bytes representation,
+// preceded by its length packed in the same variable-length format
+// used within that representation.
+type Encoder struct {
+	w   io.Writer
+	buf []byte
+}
+
+// NewEncoder returns a new encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Encode writes vc to the stream.
+func (e *Encoder) Encode(vc *VClock) error {
+	e.buf = vc.appendFrame(e.buf[:0])
+	_, err := e.w.Write(e.buf)
+	return err
+}
+
+// appendFrame appends the length-prefixed serialization of vc to buf.
+func (vc *VClock) appendFrame(buf []byte) []byte {
+	size := vc.computeBytesSize()
+	start := len(buf)
+	need := start + packedIntSize(uint64(size)) + size
+	if cap(buf) < need {
+		grown := make([]byte, start, need)
+		copy(grown, buf)
+		buf = grown
+	}
+	buf = buf[:need]
+	pos := start + packInt(uint64(size), buf[start:])
+	vc.putBytes(buf[pos:])
+	return buf
+}
+
+// A Decoder reads a sequence of vector clocks written by an Encoder
+// from an input stream.
+type Decoder struct {
+	r   io.Reader
+	buf []byte
+	n   int
+}
+
+// NewDecoder returns a new decoder that reads from r. If r does not
+// implement io.ByteReader, the decoder buffers its input and may read
+// data from r beyond the clocks it returns.
+func NewDecoder(r io.Reader) *Decoder {
+	if _, ok := r.(io.ByteReader); !ok {
+		r = bufio.NewReader(r)
+	}
+	return &Decoder{r: r}
+}
+
+// DecodeError reports a failure to decode a clock from a stream.
+type DecodeError struct {
+	// Index is the position of the offending clock in the stream,
+	// counting from zero.
+	Index int
+	Err   error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("vclock %d: %v", e.Index, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Decode reads the next clock from the stream. At the end of the
+// stream it returns io.EOF. Any other failure is reported as a
+// *DecodeError holding the index of the clock being decoded.
+func (d *Decoder) Decode() (*VClock, error) {
+	var err error
+	d.buf, _, err = readFrame(d.r, d.buf)
+	if err == nil {
+		vc := New()
+		if err = vc.fromBytes(d.buf); err == nil {
+			d.n++
+			return vc, nil
+		}
+	}
+	if err == io.EOF {
+		return nil, err
+	}
+	return nil, &DecodeError{d.n, err}
+}
+
+// io.WriterTo interface
+//
+// WriteTo writes vc to w in the length-prefixed form used by Encoder.
+func (vc *VClock) WriteTo(w io.Writer) (n int64, err error) {
+	written, err := w.Write(vc.appendFrame(nil))
+	return int64(written), err
+}
+
+// io.ReaderFrom interface
+//
+// ReadFrom reads a single clock in the length-prefixed form used by
+// Encoder, replacing any entries previously held by vc. It reads no
+// data beyond that clock. If r is already at its end, ReadFrom returns
+// io.EOF.
+func (vc *VClock) ReadFrom(r io.Reader) (n int64, err error) {
+	data, n, err := readFrame(r, nil)
+	if err != nil {
+		return n, err
+	}
+	decoded := New()
+	if err = decoded.fromBytes(data); err != nil {
+		return n, err
+	}
+	*vc = *decoded
+	return n, nil
+}
+
+var errFrameSize = errors.New("bad vclock length")
+
+// readFrame reads a length-prefixed clock from r into buf, growing it
+// as necessary, and returns the serialized clock and the number of
+// bytes consumed.
+func readFrame(r io.Reader, buf []byte) (data []byte, n int64, err error) {
+	var prefix [maxPackedIntSize]byte
+	size := 0
+	for {
+		if size == len(prefix) {
+			return buf, n, errFrameSize
+		}
+		if br, ok := r.(io.ByteReader); ok {
+			prefix[size], err = br.ReadByte()
+		} else {
+			_, err = io.ReadFull(r, prefix[size:size+1])
+		}
+		if err != nil {
+			if err == io.EOF && size > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return buf, n, err
+		}
+		n++
+		size++
+		if prefix[size-1]&0x80 == 0 {
+			break
+		}
+	}
+	// The first byte of the longest prefix only has room for the top bit
+	// of the length, and unpackInt would silently drop any more.
+	length, _, _ := unpackInt(prefix[:size])
+	if (size == len(prefix) && prefix[0]&0x7f > 1) || length > MaxSize {
+		return buf, n, errFrameSize
+	}
+	if uint64(cap(buf)) < length {
+		buf = make([]byte, length)
+	}
+	buf = buf[:length]
+	read, err := io.ReadFull(r, buf)
+	n += int64(read)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return buf, n, err
+}
@@ -0,0 +1,110 @@
+package vclock_test
+
+import (
+	"bytes"
+	"errors"
+	"github.com/jbondeson/vclock"
+	"io"
+	. "launchpad.net/gocheck"
+)
+
+func streamClocks() []*vclock.VClock {
+	vc1 := vclock.New()
+	vc1.Update("idA", 0)
+	vc2 := vclock.New()
+	vc3 := vclock.New()
+	vc3.Update("idA", 15)
+	vc3.Update("idB", 255)
+	return []*vclock.VClock{vc1, vc2, vc3}
+}
+
+func (S) TestEncoderFraming(c *C) {
+	var buf bytes.Buffer
+	enc := vclock.NewEncoder(&buf)
+	for _, vc := range streamClocks() {
+		c.Assert(enc.Encode(vc), IsNil)
+	}
+	c.Assert(buf.Bytes(), DeepEquals, []byte{
+		6, 0, 1, 3, 'i', 'd', 'A',
+		0,
+		14, 1, 1, 15, 3, 'i', 'd', 'A', 1, 129, 127, 3, 'i', 'd', 'B',
+	})
+}
+
+func (S) TestEncoderDecoder(c *C) {
+	clocks := streamClocks()
+	var buf bytes.Buffer
+	enc := vclock.NewEncoder(&buf)
+	for _, vc := range clocks {
+		c.Assert(enc.Encode(vc), IsNil)
+	}
+
+	// Hide the io.ByteReader implementation of bytes.Buffer.
+	dec := vclock.NewDecoder(struct{ io.Reader }{&buf})
+	for _, vc := range clocks {
+		decoded, err := dec.Decode()
+		c.Assert(err, IsNil)
+		c.Assert(decoded.Bytes(), DeepEquals, vc.Bytes())
+	}
+	decoded, err := dec.Decode()
+	c.Assert(err, Equals, io.EOF)
+	c.Assert(decoded, IsNil)
+}
+
+func (S) TestDecoderErrorIndex(c *C) {
+	data := []byte{
+		6, 0, 1, 3, 'i', 'd', 'A',
+		2, 128, 0,
+	}
+	dec := vclock.NewDecoder(bytes.NewReader(data))
+	_, err := dec.Decode()
+	c.Assert(err, IsNil)
+	_, err = dec.Decode()
+	c.Assert(err, ErrorMatches, "vclock 1: bad vclock header")
+	var decodeErr *vclock.DecodeError
+	c.Assert(errors.As(err, &decodeErr), Equals, true)
+	c.Assert(decodeErr.Index, Equals, 1)
+}
+
+func (S) TestDecoderTruncatedStream(c *C) {
+	for _, data := range [][]byte{{6, 0, 1, 3, 'i'}, {129}} {
+		dec := vclock.NewDecoder(bytes.NewReader(data))
+		_, err := dec.Decode()
+		c.Assert(errors.Is(err, io.ErrUnexpectedEOF), Equals, true, Commentf("%v", data))
+	}
+}
+
+func (S) TestDecoderOversizedFrame(c *C) {
+	data := []byte{255, 255, 255, 255, 255, 255, 255, 255, 255, 127}
+	dec := vclock.NewDecoder(bytes.NewReader(data))
+	_, err := dec.Decode()
+	c.Assert(err, ErrorMatches, "vclock 0: bad vclock length")
+
+	// A length overflowing 64 bits must not wrap around to a small one.
+	data = []byte{0x82, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x00}
+	dec = vclock.NewDecoder(bytes.NewReader(data))
+	_, err = dec.Decode()
+	c.Assert(err, ErrorMatches, "vclock 0: bad vclock length")
+}
+
+func (S) TestWriteToReadFrom(c *C) {
+	clocks := streamClocks()
+	var buf bytes.Buffer
+	var written int64
+	for _, vc := range clocks {
+		n, err := vc.WriteTo(&buf)
+		c.Assert(err, IsNil)
+		written += n
+	}
+	c.Assert(written, Equals, int64(buf.Len()))
+
+	for _, vc := range clocks {
+		decoded := vclock.New()
+		decoded.Update("idC", 1)
+		_, err := decoded.ReadFrom(&buf)
+		c.Assert(err, IsNil)
+		c.Assert(decoded.Bytes(), DeepEquals, vc.Bytes())
+	}
+	_, err := vclock.New().ReadFrom(&buf)
+	c.Assert(err, Equals, io.EOF)
+}
@@ -0,0 +1,168 @@
+package vclock
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var errBadString = errors.New("bad vclock string")
+
+// String returns a human-readable representation of vc, with entries
+// sorted by id and each update time following its ticks, as in
+// {idA:3@17, idB:1}. Ids holding characters other than letters, digits,
+// '_', '-', '.', and '/' are quoted. The result may be loaded by
+// ParseString.
+func (vc *VClock) String() string {
+	if vc == nil {
+		return "<nil>"
+	}
+	var buf strings.Builder
+	buf.WriteByte('{')
+	for i, item := range vc.sortedByID() {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(formatID(item.id))
+		buf.WriteByte(':')
+		buf.WriteString(strconv.FormatUint(item.ticks, 10))
+		if item.lastUpdate != 0 {
+			buf.WriteByte('@')
+			buf.WriteString(strconv.FormatUint(item.lastUpdate, 10))
+		}
+	}
+	buf.WriteByte('}')
+	return buf.String()
+}
+
+// fmt.Formatter interface
+//
+// The %v and %s verbs print vc as String does, and %q prints it quoted.
+// The %+v verb also prints the update time of every entry, and %#v
+// prints a Go expression building vc with its entries in the order they
+// are held.
+func (vc *VClock) Format(f fmt.State, verb rune) {
+	switch {
+	case vc == nil:
+		fmt.Fprint(f, "<nil>")
+	case verb == 'v' && f.Flag('#'):
+		fmt.Fprint(f, "vclock.FromEntries([]vclock.Entry{")
+		for i := range vc.items {
+			if i > 0 {
+				fmt.Fprint(f, ", ")
+			}
+			fmt.Fprintf(f, "{ID: %q, Ticks: %d, LastUpdate: %d}", vc.items[i].id, vc.items[i].ticks, vc.items[i].lastUpdate)
+		}
+		fmt.Fprint(f, "})")
+	case verb == 'v' && f.Flag('+'):
+		fmt.Fprint(f, "{")
+		for i, item := range vc.sortedByID() {
+			if i > 0 {
+				fmt.Fprint(f, ", ")
+			}
+			fmt.Fprintf(f, "%s: ticks=%d lastUpdate=%d", formatID(item.id), item.ticks, item.lastUpdate)
+		}
+		fmt.Fprint(f, "}")
+	case verb == 'v' || verb == 's':
+		fmt.Fprint(f, vc.String())
+	case verb == 'q':
+		fmt.Fprint(f, strconv.Quote(vc.String()))
+	default:
+		fmt.Fprintf(f, "%%!%c(*vclock.VClock=%s)", verb, vc.String())
+	}
+}
+
+// ParseString returns the vector clock represented by s, which must be
+// in the format produced by VClock.String. Spaces around ids and entries
+// are ignored.
+func ParseString(s string) (*VClock, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 || s[0] != '{' || s[len(s)-1] != '}' {
+		return nil, errBadString
+	}
+	s = strings.TrimSpace(s[1 : len(s)-1])
+	vc := New()
+	for s != "" {
+		var id string
+		if s[0] == '"' {
+			quoted, err := strconv.QuotedPrefix(s)
+			if err != nil {
+				return nil, errBadString
+			}
+			id, _ = strconv.Unquote(quoted)
+			s = strings.TrimSpace(s[len(quoted):])
+		} else {
+			end := strings.IndexByte(s, ':')
+			if end < 0 {
+				return nil, errBadString
+			}
+			id, s = strings.TrimSpace(s[:end]), s[end:]
+			if !isPlainID(id) {
+				return nil, errBadString
+			}
+		}
+		if s == "" || s[0] != ':' {
+			return nil, errBadString
+		}
+		entry := s[1:]
+		if end := strings.IndexByte(entry, ','); end >= 0 {
+			entry, s = entry[:end], strings.TrimSpace(entry[end+1:])
+			if s == "" {
+				return nil, errBadString
+			}
+		} else {
+			s = ""
+		}
+		ticks, when := strings.TrimSpace(entry), ""
+		at := strings.IndexByte(ticks, '@')
+		if at >= 0 {
+			ticks, when = ticks[:at], ticks[at+1:]
+		}
+		var item itemType
+		var err error
+		if item.ticks, err = strconv.ParseUint(ticks, 10, 64); err != nil {
+			return nil, errBadString
+		}
+		if at >= 0 {
+			if item.lastUpdate, err = strconv.ParseUint(when, 10, 64); err != nil {
+				return nil, errBadString
+			}
+		}
+		if _, found := vc.findItem(id); found {
+			return nil, errBadString
+		}
+		vc.updateItem(id, item.ticks, item.lastUpdate)
+	}
+	return vc, nil
+}
+
+// sortedByID returns the items in vc sorted by id.
+func (vc *VClock) sortedByID() []itemType {
+	items := make([]itemType, len(vc.items))
+	copy(items, vc.items)
+	sort.Slice(items, func(i, j int) bool { return items[i].id < items[j].id })
+	return items
+}
+
+func formatID(id string) string {
+	if isPlainID(id) {
+		return id
+	}
+	return strconv.Quote(id)
+}
+
+// isPlainID returns whether id may be represented without quotes.
+func isPlainID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for i := 0; i != len(id); i++ {
+		c := id[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_' || c == '-' || c == '.' || c == '/') {
+			return false
+		}
+	}
+	return true
+}
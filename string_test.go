@@ -0,0 +1,78 @@
+package vclock_test
+
+import (
+	"fmt"
+	"github.com/jbondeson/vclock"
+	. "launchpad.net/gocheck"
+)
+
+func (S) TestString(c *C) {
+	vc := vclock.New()
+	c.Assert(vc.String(), Equals, "{}")
+	vc.Update("idB", 0)
+	vc.Update("idA", 5)
+	vc.Update("idA", 17)
+	vc.Update("idA", 0)
+	c.Assert(vc.String(), Equals, "{idA:3@17, idB:1}")
+	vc.Update("n1@host", 2)
+	vc.Update("", 0)
+	c.Assert(vc.String(), Equals, `{"":1, idA:3@17, idB:1, "n1@host":1@2}`)
+
+	var nilVC *vclock.VClock
+	c.Assert(nilVC.String(), Equals, "<nil>")
+}
+
+func (S) TestParseString(c *C) {
+	for _, s := range []string{
+		"{}",
+		"{idA:3@17, idB:1}",
+		`{"":1, idA:3@17, "n1@host":1@2, "say \"hi\"":7}`,
+	} {
+		vc, err := vclock.ParseString(s)
+		c.Assert(err, IsNil, Commentf(s))
+		c.Assert(vc.String(), Equals, s)
+	}
+
+	vc, err := vclock.ParseString(" { idB:1 ,idA : 2@3 } ")
+	c.Assert(err, IsNil)
+	c.Assert(vc.Entries(), DeepEquals, []vclock.Entry{
+		{ID: "idB", Ticks: 1},
+		{ID: "idA", Ticks: 2, LastUpdate: 3},
+	})
+}
+
+func (S) TestParseStringWithBadData(c *C) {
+	for _, s := range []string{
+		"",
+		"idA:1",
+		"{idA}",
+		"{idA:}",
+		"{idA:x}",
+		"{idA:1@}",
+		"{idA:1@x}",
+		"{idA:-1}",
+		"{idA:1,}",
+		"{idA:1, idA:2}",
+		"{id A:1}",
+		`{"idA:1}`,
+		`{"idA"1}`,
+	} {
+		vc, err := vclock.ParseString(s)
+		c.Assert(err, ErrorMatches, "bad vclock string", Commentf(s))
+		c.Assert(vc, IsNil)
+	}
+}
+
+func (S) TestFormat(c *C) {
+	vc := vclock.New()
+	vc.Update("idB", 0)
+	vc.Update("idA", 17)
+	c.Assert(fmt.Sprintf("%v", vc), Equals, "{idA:1@17, idB:1}")
+	c.Assert(fmt.Sprintf("%s", vc), Equals, "{idA:1@17, idB:1}")
+	c.Assert(fmt.Sprintf("%q", vc), Equals, `"{idA:1@17, idB:1}"`)
+	c.Assert(fmt.Sprintf("%+v", vc), Equals, "{idA: ticks=1 lastUpdate=17, idB: ticks=1 lastUpdate=0}")
+	c.Assert(fmt.Sprintf("%#v", vc), Equals,
+		`vclock.FromEntries([]vclock.Entry{{ID: "idB", Ticks: 1, LastUpdate: 0}, {ID: "idA", Ticks: 1, LastUpdate: 17}})`)
+	c.Assert(fmt.Sprintf("%d", vc), Equals, "%!d(*vclock.VClock={idA:1@17, idB:1})")
+	c.Assert(fmt.Sprintf("%v", []*vclock.VClock{vc, nil}), Equals, "[{idA:1@17, idB:1} <nil>]")
+}
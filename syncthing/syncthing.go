@@ -0,0 +1,143 @@
+// Package syncthing converts vector clocks to and from Syncthing's
+// version vectors.
+//
+// A Syncthing version vector is the Protocol Buffers message:
+//
+//	message Vector {
+//	  repeated Counter counters = 1;
+//	}
+//
+//	message Counter {
+//	  uint64 id    = 1;
+//	  uint64 value = 2;
+//	}
+//
+// where each counter id is the short id of a device. Counter values map
+// onto vclock ticks. Syncthing keeps no update times, so these are lost
+// on export and zero on import.
+package syncthing
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/jbondeson/vclock"
+	"github.com/jbondeson/vclock/internal/protowire"
+	"sort"
+	"strconv"
+)
+
+// IDMap converts between vclock ids and Syncthing short device ids.
+// Either function may be nil, in which case device ids are represented
+// as vclock ids holding their decimal form.
+type IDMap struct {
+	DeviceID func(id string) (uint64, error)
+	ID       func(device uint64) (string, error)
+}
+
+func (m *IDMap) deviceID(id string) (uint64, error) {
+	if m != nil && m.DeviceID != nil {
+		return m.DeviceID(id)
+	}
+	device, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("vclock id %q is not a syncthing device id", id)
+	}
+	return device, nil
+}
+
+func (m *IDMap) id(device uint64) (string, error) {
+	if m != nil && m.ID != nil {
+		return m.ID(device)
+	}
+	return strconv.FormatUint(device, 10), nil
+}
+
+var errBadVector = errors.New("bad syncthing vector")
+
+// Marshal returns the Protocol Buffers encoding of vc as a Syncthing
+// Vector message, with ids converted to device ids by m, which may be nil.
+// Counters are sorted by device id, as Syncthing keeps them.
+func Marshal(vc *vclock.VClock, m *IDMap) ([]byte, error) {
+	type counter struct {
+		device uint64
+		value  uint64
+	}
+	entries := vc.Entries()
+	counters := make([]counter, len(entries))
+	for i, e := range entries {
+		device, err := m.deviceID(e.ID)
+		if err != nil {
+			return nil, err
+		}
+		counters[i] = counter{device, e.Ticks}
+	}
+	sort.Slice(counters, func(i, j int) bool { return counters[i].device < counters[j].device })
+
+	out := []byte{}
+	for i, c := range counters {
+		if i > 0 && c.device == counters[i-1].device {
+			return nil, fmt.Errorf("duplicate syncthing device id %d", c.device)
+		}
+		var msg []byte
+		if c.device != 0 {
+			msg = binary.AppendUvarint(append(msg, 1<<3|protowire.Varint), c.device)
+		}
+		if c.value != 0 {
+			msg = binary.AppendUvarint(append(msg, 2<<3|protowire.Varint), c.value)
+		}
+		out = binary.AppendUvarint(append(out, 1<<3|protowire.Bytes), uint64(len(msg)))
+		out = append(out, msg...)
+	}
+	return out, nil
+}
+
+// Unmarshal returns the vector clock represented by the Protocol Buffers
+// encoding of a Syncthing Vector message in data, with device ids converted
+// to vclock ids by m, which may be nil. Unknown fields are skipped.
+func Unmarshal(data []byte, m *IDMap) (*vclock.VClock, error) {
+	if len(data) > vclock.MaxSize {
+		return nil, errBadVector
+	}
+	var entries []vclock.Entry
+	seen := make(map[uint64]bool)
+	for len(data) > 0 {
+		field, wire, value, rest, ok := protowire.Next(data)
+		if !ok {
+			return nil, errBadVector
+		}
+		data = rest
+		if field != 1 {
+			continue
+		}
+		if wire != protowire.Bytes {
+			return nil, errBadVector
+		}
+		var device, counter uint64
+		for len(value) > 0 {
+			field, wire, fieldValue, rest, ok := protowire.Next(value)
+			if !ok {
+				return nil, errBadVector
+			}
+			value = rest
+			switch {
+			case field == 1 && wire == protowire.Varint:
+				device, _ = binary.Uvarint(fieldValue)
+			case field == 2 && wire == protowire.Varint:
+				counter, _ = binary.Uvarint(fieldValue)
+			case field <= 2:
+				return nil, errBadVector
+			}
+		}
+		if seen[device] {
+			return nil, errBadVector
+		}
+		seen[device] = true
+		id, err := m.id(device)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, vclock.Entry{ID: id, Ticks: counter})
+	}
+	return vclock.FromEntries(entries), nil
+}
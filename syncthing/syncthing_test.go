@@ -0,0 +1,95 @@
+package syncthing_test
+
+import (
+	"github.com/jbondeson/vclock"
+	"github.com/jbondeson/vclock/syncthing"
+	. "launchpad.net/gocheck"
+	"strconv"
+	"testing"
+)
+
+func TestAll(c *testing.T) {
+	TestingT(c)
+}
+
+type S struct{}
+
+var _ = Suite(&S{})
+
+func (S) TestMarshal(c *C) {
+	vc := vclock.FromEntries([]vclock.Entry{
+		{ID: "300", Ticks: 1, LastUpdate: 5},
+		{ID: "2", Ticks: 150},
+	})
+	data, err := syncthing.Marshal(vc, nil)
+	c.Assert(err, IsNil)
+	c.Assert(data, DeepEquals, []byte{
+		0x0a, 0x05, 0x08, 0x02, 0x10, 0x96, 0x01,
+		0x0a, 0x05, 0x08, 0xac, 0x02, 0x10, 0x01,
+	})
+
+	decoded, err := syncthing.Unmarshal(data, nil)
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Entries(), DeepEquals, []vclock.Entry{
+		{ID: "2", Ticks: 150},
+		{ID: "300", Ticks: 1},
+	})
+}
+
+func (S) TestEmpty(c *C) {
+	data, err := syncthing.Marshal(vclock.New(), nil)
+	c.Assert(err, IsNil)
+	c.Assert(data, DeepEquals, []byte{})
+	decoded, err := syncthing.Unmarshal(data, nil)
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Len(), Equals, 0)
+}
+
+func (S) TestIDMap(c *C) {
+	m := &syncthing.IDMap{
+		DeviceID: func(id string) (uint64, error) {
+			return strconv.ParseUint(id, 16, 64)
+		},
+		ID: func(device uint64) (string, error) {
+			return strconv.FormatUint(device, 16), nil
+		},
+	}
+	vc := vclock.New()
+	vc.Update("ffffffffffffffff", 0)
+	data, err := syncthing.Marshal(vc, m)
+	c.Assert(err, IsNil)
+	c.Assert(data, DeepEquals, []byte{
+		0x0a, 0x0d, 0x08, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01, 0x10, 0x01,
+	})
+	decoded, err := syncthing.Unmarshal(data, m)
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Compare(vc, vclock.Equal), Equals, true)
+
+	_, err = syncthing.Marshal(vc, nil)
+	c.Assert(err, ErrorMatches, `vclock id "ffffffffffffffff" is not a syncthing device id`)
+}
+
+func (S) TestUnmarshalUnknownFields(c *C) {
+	data := []byte{
+		0x12, 0x01, 'X',
+		0x0a, 0x09, 0x10, 0x03, 0x1d, 1, 2, 3, 4, 0x08, 0x07,
+	}
+	vc, err := syncthing.Unmarshal(data, nil)
+	c.Assert(err, IsNil)
+	c.Assert(vc.Entries(), DeepEquals, []vclock.Entry{{ID: "7", Ticks: 3}})
+}
+
+func (S) TestUnmarshalWithBadData(c *C) {
+	for _, data := range [][]byte{
+		{0x0a},
+		{0x08, 0x01},
+		{0x0a, 0x02, 0x08, 0x80},
+		{0x0a, 0x02, 0x0a, 0x00},
+		{0x0a, 0x02, 0x08, 0x01, 0x0a, 0x02, 0x08, 0x01},
+		{0x0b},
+	} {
+		vc, err := syncthing.Unmarshal(data, nil)
+		c.Assert(err, ErrorMatches, "bad syncthing vector", Commentf("%v", data))
+		c.Assert(vc, IsNil)
+	}
+}
@@ -0,0 +1,91 @@
+package vclock
+
+import (
+	"time"
+)
+
+// TimeSource provides the current time, allowing it to be faked in tests.
+type TimeSource interface {
+	Now() time.Time
+}
+
+// Timebase converts between wall-clock times and the update times held
+// by vector clocks, which count Resolution units since Epoch.
+//
+// The zero Timebase counts seconds since the Unix epoch, according to
+// the system clock.
+type Timebase struct {
+	// Epoch is the time corresponding to an update time of zero.
+	// If zero, the Unix epoch is used.
+	Epoch time.Time
+	// Resolution is the duration of one update time unit.
+	// If zero, one second is used.
+	Resolution time.Duration
+	// Source provides the current time. If nil, the system clock is used.
+	Source TimeSource
+}
+
+var unixEpoch = time.Unix(0, 0)
+
+func (tb Timebase) epoch() time.Time {
+	if tb.Epoch.IsZero() {
+		return unixEpoch
+	}
+	return tb.Epoch
+}
+
+func (tb Timebase) resolution() time.Duration {
+	if tb.Resolution <= 0 {
+		return time.Second
+	}
+	return tb.Resolution
+}
+
+// Now returns the current time according to tb.Source.
+func (tb Timebase) Now() time.Time {
+	if tb.Source == nil {
+		return time.Now()
+	}
+	return tb.Source.Now()
+}
+
+// When returns the update time corresponding to t, rounded down to the
+// resolution of tb. Times prior to the epoch of tb map to zero.
+func (tb Timebase) When(t time.Time) uint64 {
+	epoch := tb.epoch()
+	if !t.After(epoch) {
+		return 0
+	}
+	return uint64(t.Sub(epoch) / tb.resolution())
+}
+
+// Time returns the wall-clock time corresponding to the update time when.
+func (tb Timebase) Time(when uint64) time.Time {
+	return tb.epoch().Add(time.Duration(when) * tb.resolution())
+}
+
+// UpdateNow increments id's clock ticks in vc, as Update does, with the
+// current time as the update time.
+func (tb Timebase) UpdateNow(vc *VClock, id string) {
+	vc.Update(id, tb.When(tb.Now()))
+}
+
+// UpdateAt increments id's clock ticks in vc, as Update does, with t as
+// the update time.
+func (tb Timebase) UpdateAt(vc *VClock, id string, t time.Time) {
+	vc.Update(id, tb.When(t))
+}
+
+// UpdateNow increments id's clock ticks in vc, using as the update time
+// the number of seconds since the Unix epoch according to the system
+// clock. Use Timebase.UpdateNow for a different time base or source.
+func (vc *VClock) UpdateNow(id string) {
+	Timebase{}.UpdateNow(vc, id)
+}
+
+// UpdateAt increments id's clock ticks in vc, using as the update time
+// the number of seconds from the Unix epoch to t. Use Timebase.UpdateAt
+// for a different time base.
+func (vc *VClock) UpdateAt(id string, t time.Time) {
+	Timebase{}.UpdateAt(vc, id, t)
+}
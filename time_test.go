@@ -0,0 +1,83 @@
+package vclock_test
+
+import (
+	"github.com/jbondeson/vclock"
+	. "launchpad.net/gocheck"
+	"time"
+)
+
+type fakeTime struct {
+	now time.Time
+}
+
+func (f *fakeTime) Now() time.Time {
+	return f.now
+}
+
+func (S) TestTimebaseDefault(c *C) {
+	var tb vclock.Timebase
+	c.Assert(tb.When(time.Unix(1700000000, 999999999)), Equals, uint64(1700000000))
+	c.Assert(tb.When(time.Unix(-5, 0)), Equals, uint64(0))
+	c.Assert(tb.Time(1700000000).Equal(time.Unix(1700000000, 0)), Equals, true)
+
+	before := uint64(time.Now().Unix())
+	vc := vclock.New()
+	vc.UpdateNow("idA")
+	after := uint64(time.Now().Unix())
+	c.Assert(vc.LastUpdate() >= before && vc.LastUpdate() <= after, Equals, true)
+
+	vc.UpdateAt("idB", time.Unix(1700000000, 0))
+	c.Assert(vc.Entries()[1], Equals, vclock.Entry{ID: "idB", Ticks: 1, LastUpdate: 1700000000})
+}
+
+func (S) TestTimebaseCustom(c *C) {
+	epoch := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	source := &fakeTime{epoch.Add(90 * time.Minute)}
+	tb := vclock.Timebase{Epoch: epoch, Resolution: time.Minute, Source: source}
+
+	vc := vclock.New()
+	tb.UpdateNow(vc, "idA")
+	tb.UpdateAt(vc, "idB", epoch.Add(150*time.Second))
+	c.Assert(vc.Entries(), DeepEquals, []vclock.Entry{
+		{ID: "idA", Ticks: 1, LastUpdate: 90},
+		{ID: "idB", Ticks: 1, LastUpdate: 2},
+	})
+	c.Assert(tb.Now(), Equals, source.now)
+	c.Assert(tb.Time(90), Equals, source.now)
+}
+
+func (S) TestTruncateByAge(c *C) {
+	source := &fakeTime{time.Unix(1000, 0)}
+	tb := vclock.Timebase{Source: source}
+	vc := vclock.New()
+	for i, id := range []string{"idA", "idB", "idC", "idD"} {
+		tb.UpdateAt(vc, id, source.now.Add(-time.Duration(i)*time.Minute))
+	}
+
+	t := &vclock.Truncation{CutAge: 90 * time.Second, Timebase: tb}
+	c.Assert(vc.Truncate(t).Entries(), DeepEquals, []vclock.Entry{
+		{ID: "idA", Ticks: 1, LastUpdate: 1000},
+		{ID: "idB", Ticks: 1, LastUpdate: 940},
+	})
+
+	// As time goes by, more entries become too old.
+	source.now = source.now.Add(time.Minute)
+	truncated, dropped := vc.TruncateWithReport(t)
+	c.Assert(truncated.Entries(), DeepEquals, []vclock.Entry{{ID: "idA", Ticks: 1, LastUpdate: 1000}})
+	c.Assert(dropped, HasLen, 3)
+	c.Assert(dropped[0].Reason, Equals, vclock.DroppedByCutBefore)
+
+	// KeepAge preserves entries regardless of CutAboveN.
+	t = &vclock.Truncation{CutAboveN: 1, KeepAge: 2 * time.Minute, Timebase: tb}
+	inPlace := vc.Copy()
+	inPlace.TruncateInPlace(t)
+	c.Assert(inPlace.Entries(), DeepEquals, []vclock.Entry{
+		{ID: "idA", Ticks: 1, LastUpdate: 1000},
+		{ID: "idB", Ticks: 1, LastUpdate: 940},
+	})
+
+	// The most recent of CutBefore and CutAge applies.
+	t = &vclock.Truncation{CutBefore: 1000, CutAge: time.Hour, Timebase: tb}
+	c.Assert(vc.Truncate(t).Len(), Equals, 1)
+	c.Assert(vc.Truncate(vclock.And(t)).Len(), Equals, 1)
+}
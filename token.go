@@ -0,0 +1,192 @@
+package vclock
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// TokenErrorKind classifies the reasons for rejecting a token.
+type TokenErrorKind int
+
+const (
+	// TokenMalformed reports a token that is truncated, badly encoded,
+	// or holds an invalid clock.
+	TokenMalformed TokenErrorKind = iota + 1
+	// TokenUnknownKey reports a token signed with a key that is not
+	// known to the codec.
+	TokenUnknownKey
+	// TokenBadSignature reports a token whose content does not match
+	// its signature or, for sealed tokens, that fails authentication,
+	// as when presented for a different resource.
+	TokenBadSignature
+)
+
+// TokenError reports a token that was rejected by a TokenCodec.
+type TokenError struct {
+	Kind  TokenErrorKind
+	KeyID string
+}
+
+func (e *TokenError) Error() string {
+	switch e.Kind {
+	case TokenUnknownKey:
+		return fmt.Sprintf("vclock token signed with unknown key %q", e.KeyID)
+	case TokenBadSignature:
+		return "vclock token signature mismatch"
+	}
+	return "malformed vclock token"
+}
+
+const (
+	tokenVersion       = 1
+	sealedTokenVersion = 2
+)
+
+// minTokenKeySize is the shortest key accepted by a TokenCodec, which
+// matches the size of the HMAC-SHA256 output.
+const minTokenKeySize = sha256.Size
+
+var errTokenKeySize = errors.New("vclock token key shorter than 32 bytes")
+
+// TokenCodec converts vector clocks to and from opaque tokens that may be
+// handed to untrusted parties, such as HTTP clients providing causal
+// context, and verified when they are returned.
+//
+// Tokens hold the Bytes representation of the clock, the id of the key
+// used to sign them, and an HMAC-SHA256 signature. Keys may be rotated:
+// new tokens are always signed with the current key, while tokens signed
+// with any other known key are still accepted.
+//
+// A TokenCodec is safe for concurrent use.
+type TokenCodec struct {
+	mu      sync.RWMutex
+	current string
+	keys    map[string][]byte
+}
+
+// NewTokenCodec returns a codec signing tokens with key, identified
+// within tokens by keyID. The key must be at least 32 bytes long.
+func NewTokenCodec(keyID string, key []byte) (*TokenCodec, error) {
+	tc := &TokenCodec{keys: make(map[string][]byte)}
+	if err := tc.Rotate(keyID, key); err != nil {
+		return nil, err
+	}
+	return tc, nil
+}
+
+// AddKey makes tc accept tokens signed with key under keyID, without
+// using it to sign new tokens.
+func (tc *TokenCodec) AddKey(keyID string, key []byte) error {
+	if len(key) < minTokenKeySize {
+		return errTokenKeySize
+	}
+	tc.mu.Lock()
+	tc.keys[keyID] = append([]byte(nil), key...)
+	tc.mu.Unlock()
+	return nil
+}
+
+// Rotate makes key, identified by keyID, the one used to sign new tokens.
+// Tokens signed with previous keys remain accepted until they are removed.
+func (tc *TokenCodec) Rotate(keyID string, key []byte) error {
+	if len(key) < minTokenKeySize {
+		return errTokenKeySize
+	}
+	tc.mu.Lock()
+	tc.keys[keyID] = append([]byte(nil), key...)
+	tc.current = keyID
+	tc.mu.Unlock()
+	return nil
+}
+
+// RemoveKey stops tc from accepting tokens signed under keyID.
+// The current key cannot be removed.
+func (tc *TokenCodec) RemoveKey(keyID string) {
+	tc.mu.Lock()
+	if keyID != tc.current {
+		delete(tc.keys, keyID)
+	}
+	tc.mu.Unlock()
+}
+
+// Encode returns a signed token holding vc.
+//
+// The format of the decoded token is:
+//
+//	[ version byte | key id len | key id | clock bytes | signature ]
+//
+// and the token itself is its unpadded base64 URL encoding.
+func (tc *TokenCodec) Encode(vc *VClock) string {
+	tc.mu.RLock()
+	keyID, key := tc.current, tc.keys[tc.current]
+	tc.mu.RUnlock()
+
+	size := vc.computeBytesSize()
+	token := tokenHeader(tokenVersion, keyID, size+sha256.Size)
+	start := len(token)
+	token = token[:start+size]
+	vc.putBytes(token[start:])
+	mac := hmac.New(sha256.New, key)
+	mac.Write(token)
+	token = mac.Sum(token)
+	return base64.RawURLEncoding.EncodeToString(token)
+}
+
+// Decode returns the vector clock held by token, which must have been
+// generated by Encode with a key known to tc. Rejected tokens are
+// reported with a *TokenError.
+func (tc *TokenCodec) Decode(token string) (*VClock, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, &TokenError{Kind: TokenMalformed}
+	}
+	keyID, payload, ok := splitToken(data, tokenVersion, sha256.Size)
+	if !ok {
+		return nil, &TokenError{Kind: TokenMalformed}
+	}
+	tc.mu.RLock()
+	key, found := tc.keys[keyID]
+	tc.mu.RUnlock()
+	if !found {
+		return nil, &TokenError{Kind: TokenUnknownKey, KeyID: keyID}
+	}
+	signed := data[:len(data)-sha256.Size]
+	mac := hmac.New(sha256.New, key)
+	mac.Write(signed)
+	if !hmac.Equal(mac.Sum(nil), data[len(signed):]) {
+		return nil, &TokenError{Kind: TokenBadSignature, KeyID: keyID}
+	}
+	vc, err := FromBytes(payload[:len(payload)-sha256.Size])
+	if err != nil {
+		return nil, &TokenError{Kind: TokenMalformed, KeyID: keyID}
+	}
+	return vc, nil
+}
+
+// tokenHeader returns a token holding the version and key id, with
+// capacity for extra more bytes.
+func tokenHeader(version byte, keyID string, extra int) []byte {
+	size := 1 + packedIntSize(uint64(len(keyID))) + len(keyID)
+	token := make([]byte, size, size+extra)
+	token[0] = version
+	pos := 1 + packInt(uint64(len(keyID)), token[1:])
+	copy(token[pos:], keyID)
+	return token
+}
+
+// splitToken splits a token of the given version into its key id and the
+// data following it, which must be at least trailer bytes long.
+func splitToken(data []byte, version byte, trailer int) (keyID string, rest []byte, ok bool) {
+	if len(data) == 0 || data[0] != version {
+		return "", nil, false
+	}
+	keyID, rest, ok = unpackID(data[1:])
+	if !ok || len(rest) < trailer {
+		return "", nil, false
+	}
+	return keyID, rest, true
+}
@@ -0,0 +1,138 @@
+package vclock_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"github.com/jbondeson/vclock"
+	. "launchpad.net/gocheck"
+)
+
+var (
+	tokenKey1 = bytes.Repeat([]byte{1}, 32)
+	tokenKey2 = bytes.Repeat([]byte{2}, 32)
+	tokenKey3 = bytes.Repeat([]byte{3}, 48)
+)
+
+func tokenTestCodec(c *C, keyID string, key []byte) *vclock.TokenCodec {
+	tc, err := vclock.NewTokenCodec(keyID, key)
+	c.Assert(err, IsNil)
+	return tc
+}
+
+func tokenTestClock() *vclock.VClock {
+	vc := vclock.New()
+	vc.Update("idA", 5)
+	vc.Update("idB", 7)
+	return vc
+}
+
+func tokenErrorKind(err error) vclock.TokenErrorKind {
+	var tokenErr *vclock.TokenError
+	if errors.As(err, &tokenErr) {
+		return tokenErr.Kind
+	}
+	return 0
+}
+
+func (S) TestTokenRoundTrip(c *C) {
+	tc := tokenTestCodec(c, "k1", tokenKey1)
+	vc := tokenTestClock()
+	token := tc.Encode(vc)
+	decoded, err := tc.Decode(token)
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Bytes(), DeepEquals, vc.Bytes())
+
+	token = tc.Encode(vclock.New())
+	decoded, err = tc.Decode(token)
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Len(), Equals, 0)
+}
+
+func (S) TestTokenKeyRotation(c *C) {
+	tc := tokenTestCodec(c, "k1", tokenKey1)
+	vc := tokenTestClock()
+	old := tc.Encode(vc)
+
+	c.Assert(tc.Rotate("k2", tokenKey2), IsNil)
+	current := tc.Encode(vc)
+	c.Assert(current, Not(Equals), old)
+	for _, token := range []string{old, current} {
+		decoded, err := tc.Decode(token)
+		c.Assert(err, IsNil)
+		c.Assert(decoded.Bytes(), DeepEquals, vc.Bytes())
+	}
+
+	tc.RemoveKey("k1")
+	_, err := tc.Decode(old)
+	c.Assert(err, ErrorMatches, `vclock token signed with unknown key "k1"`)
+	c.Assert(tokenErrorKind(err), Equals, vclock.TokenUnknownKey)
+
+	// The current key is never removed.
+	tc.RemoveKey("k2")
+	_, err = tc.Decode(current)
+	c.Assert(err, IsNil)
+
+	// Other codecs may verify tokens signed with keys they don't sign with.
+	verifier := tokenTestCodec(c, "k3", tokenKey3)
+	c.Assert(verifier.AddKey("k2", tokenKey2), IsNil)
+	_, err = verifier.Decode(current)
+	c.Assert(err, IsNil)
+}
+
+func (S) TestTokenShortKey(c *C) {
+	tc, err := vclock.NewTokenCodec("k1", nil)
+	c.Assert(err, ErrorMatches, "vclock token key shorter than 32 bytes")
+	c.Assert(tc, IsNil)
+	_, err = vclock.NewTokenCodec("k1", []byte("secret"))
+	c.Assert(err, ErrorMatches, "vclock token key shorter than 32 bytes")
+
+	tc = tokenTestCodec(c, "k1", tokenKey1)
+	c.Assert(tc.Rotate("k2", tokenKey1[:31]), ErrorMatches, "vclock token key shorter than 32 bytes")
+	c.Assert(tc.AddKey("k3", []byte{}), ErrorMatches, "vclock token key shorter than 32 bytes")
+
+	// Rejected keys are not used.
+	token := tc.Encode(tokenTestClock())
+	verifier := tokenTestCodec(c, "k1", tokenKey1)
+	_, err = verifier.Decode(token)
+	c.Assert(err, IsNil)
+}
+
+func (S) TestTokenTampered(c *C) {
+	tc := tokenTestCodec(c, "k1", tokenKey1)
+	data, err := base64.RawURLEncoding.DecodeString(tc.Encode(tokenTestClock()))
+	c.Assert(err, IsNil)
+
+	for i := range data {
+		for _, bit := range []byte{0x01, 0x80} {
+			tampered := append([]byte(nil), data...)
+			tampered[i] ^= bit
+			vc, err := tc.Decode(base64.RawURLEncoding.EncodeToString(tampered))
+			c.Assert(err, NotNil, Commentf("byte %d", i))
+			c.Assert(vc, IsNil)
+			c.Assert(tokenErrorKind(err), Not(Equals), vclock.TokenErrorKind(0))
+		}
+	}
+
+	// Forged with the wrong key.
+	forger := tokenTestCodec(c, "k1", tokenKey2)
+	_, err = tc.Decode(forger.Encode(tokenTestClock()))
+	c.Assert(err, ErrorMatches, "vclock token signature mismatch")
+	c.Assert(tokenErrorKind(err), Equals, vclock.TokenBadSignature)
+}
+
+func (S) TestTokenTruncated(c *C) {
+	tc := tokenTestCodec(c, "k1", tokenKey1)
+	token := tc.Encode(tokenTestClock())
+	for i := 0; i < len(token); i++ {
+		vc, err := tc.Decode(token[:i])
+		c.Assert(err, NotNil, Commentf("length %d", i))
+		c.Assert(vc, IsNil)
+		c.Assert(tokenErrorKind(err), Not(Equals), vclock.TokenErrorKind(0))
+	}
+	_, err := tc.Decode(token[:4])
+	c.Assert(err, ErrorMatches, "malformed vclock token")
+	c.Assert(tokenErrorKind(err), Equals, vclock.TokenMalformed)
+	_, err = tc.Decode("!" + token)
+	c.Assert(tokenErrorKind(err), Equals, vclock.TokenMalformed)
+}
@@ -0,0 +1,635 @@
+package vclock
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// TruncationPolicy decides which entries of a vector clock are preserved
+// by Truncate.
+type TruncationPolicy interface {
+	// Keep sets keep[i] to true for each entries[i] that must be preserved.
+	// Entries are ordered from the most to the least recently updated, with
+	// ties ordered by id, and keep holds only false values on entrance.
+	Keep(entries []Entry, keep []bool)
+}
+
+// TruncationReason identifies the rule that dropped an entry during
+// truncation.
+type TruncationReason int
+
+const (
+	// DroppedByPolicy reports an entry dropped by a TruncationPolicy
+	// defined outside this package.
+	DroppedByPolicy TruncationReason = iota
+	// DroppedByCutBefore reports an entry last updated prior to
+	// Truncation.CutBefore.
+	DroppedByCutBefore
+	// DroppedByCutAboveN reports an entry that would get the clock above
+	// Truncation.CutAboveN entries.
+	DroppedByCutAboveN
+	// DroppedByLRU reports an entry outside the LRU.N most recently
+	// updated ones.
+	DroppedByLRU
+	// DroppedByMaxAge reports an entry older than MaxAge.Age.
+	DroppedByMaxAge
+	// DroppedByMaxBytes reports an entry dropped to fit the clock within
+	// Truncation.MaxBytes.
+	DroppedByMaxBytes
+)
+
+var reasonNames = []string{
+	DroppedByPolicy:    "policy",
+	DroppedByCutBefore: "cut-before",
+	DroppedByCutAboveN: "cut-above-n",
+	DroppedByLRU:       "lru",
+	DroppedByMaxAge:    "max-age",
+	DroppedByMaxBytes:  "max-bytes",
+}
+
+func (r TruncationReason) String() string {
+	if r >= 0 && int(r) < len(reasonNames) {
+		return reasonNames[r]
+	}
+	return "unknown"
+}
+
+// DroppedEntry holds an entry removed by TruncateWithReport, and the
+// rule that removed it.
+type DroppedEntry struct {
+	Entry
+	Reason TruncationReason
+}
+
+// explainer is implemented by the policies in this package, which
+// besides deciding on the entries to keep, report why the remaining
+// ones are dropped.
+type explainer interface {
+	explain(entries []Entry, keep []bool, reasons []TruncationReason)
+}
+
+// explain runs p on entries, filling reasons for the dropped ones.
+func explain(p TruncationPolicy, entries []Entry, keep []bool, reasons []TruncationReason) {
+	if e, ok := p.(explainer); ok {
+		e.explain(entries, keep, reasons)
+		return
+	}
+	p.Keep(entries, keep)
+	for i := range keep {
+		if !keep[i] {
+			reasons[i] = DroppedByPolicy
+		}
+	}
+}
+
+// dropper is implemented by the policies in this package, which can tell
+// cheaply whether they might drop any entries of a clock, so that the
+// work of truncating it may be skipped when they can't.
+type dropper interface {
+	// mayDrop returns whether the policy might drop any entries of vc.
+	// It never returns false when Keep would drop an entry.
+	mayDrop(vc *VClock) bool
+}
+
+// mayDrop returns whether p might drop any entries of vc, which is
+// assumed unless p tells otherwise.
+func mayDrop(p TruncationPolicy, vc *VClock) bool {
+	if d, ok := p.(dropper); ok {
+		return d.mayDrop(vc)
+	}
+	return len(vc.items) > 0
+}
+
+// Truncation defines a truncation strategy for use with Truncate.
+type Truncation struct {
+	// If the number of entries in the vector clock is <= KeepMinN or all the
+	// remaining entries were updated on or after KeepAfter, truncation stops.
+	// Otherwise, the oldest entries last updated prior to CutBefore, or getting
+	// the vc above CutAboveN entries are dropped.
+	KeepMinN  int
+	KeepAfter uint64
+	CutAboveN int
+	CutBefore uint64
+
+	// If MaxBytes is positive, the oldest remaining entries are further
+	// dropped, regardless of KeepMinN and KeepAfter, until the size of the
+	// Bytes representation of the vc is at most MaxBytes. When t is combined
+	// with And the budget still holds, but Or may keep entries beyond it.
+	// Pin accounts for the entries it preserves, but never drops them to
+	// fit, so the budget is only exceeded when they alone exceed it.
+	MaxBytes int
+
+	// If positive, KeepAge and CutAge work as KeepAfter and CutBefore set
+	// to the current time minus the respective age, as told by Timebase.
+	// When both forms of a rule are set, the most recent time is used.
+	KeepAge  time.Duration
+	CutAge   time.Duration
+	Timebase Timebase
+}
+
+// Keep implements the TruncationPolicy interface.
+func (t *Truncation) Keep(entries []Entry, keep []bool) {
+	r := t.resolved()
+	r.keepRules(entries, keep)
+	if r.MaxBytes > 0 {
+		fitBytes(entries, keep, nil, r.MaxBytes, nil)
+	}
+}
+
+// resolved returns a copy of t with KeepAge and CutAge turned into
+// the equivalent KeepAfter and CutBefore times.
+func (t *Truncation) resolved() Truncation {
+	r := *t
+	if t.KeepAge <= 0 && t.CutAge <= 0 {
+		return r
+	}
+	now := t.Timebase.Now()
+	if t.KeepAge > 0 {
+		r.KeepAfter = max(r.KeepAfter, t.Timebase.When(now.Add(-t.KeepAge)))
+	}
+	if t.CutAge > 0 {
+		r.CutBefore = max(r.CutBefore, t.Timebase.When(now.Add(-t.CutAge)))
+	}
+	r.KeepAge, r.CutAge = 0, 0
+	return r
+}
+
+// keepRules decides on entries according to all the rules of t but
+// MaxBytes. Like the other helpers below, it ignores KeepAge and CutAge,
+// so t must have been resolved.
+func (t *Truncation) keepRules(entries []Entry, keep []bool) {
+	kept := 0
+	for i := range entries {
+		if t.keeps(kept, entries[i].LastUpdate) {
+			keep[i] = true
+			kept++
+		}
+	}
+}
+
+// keeps returns whether t preserves an entry last updated at lastUpdate,
+// given the number of more recently updated entries already preserved.
+// MaxBytes is not considered.
+func (t *Truncation) keeps(kept int, lastUpdate uint64) bool {
+	return kept < t.KeepMinN ||
+		(t.KeepAfter > 0 && lastUpdate >= t.KeepAfter) ||
+		((t.CutAboveN == 0 || kept < t.CutAboveN) && lastUpdate >= t.CutBefore)
+}
+
+// keepItems is equivalent to Keep, but works on items ordered by age
+// without allocating memory. The preserved items are moved to the start
+// of items, and the dropped ones after them, and their number is
+// returned.
+func (t *Truncation) keepItems(items []itemType) int {
+	kept := 0
+	for i := range items {
+		if t.keeps(kept, items[i].lastUpdate) {
+			items[kept], items[i] = items[i], items[kept]
+			kept++
+		}
+	}
+	if t.MaxBytes > 0 {
+		size, timesSize, timed := 0, 0, 0
+		for i := 0; i != kept; i++ {
+			size += entryBytesSize(items[i].id, items[i].ticks)
+			timesSize += packedIntSize(items[i].lastUpdate)
+			if items[i].lastUpdate > 0 {
+				timed++
+			}
+		}
+		for kept > 0 && bytesSize(size, timesSize, timed) > t.MaxBytes {
+			kept--
+			size -= entryBytesSize(items[kept].id, items[kept].ticks)
+			timesSize -= packedIntSize(items[kept].lastUpdate)
+			if items[kept].lastUpdate > 0 {
+				timed--
+			}
+		}
+	}
+	return kept
+}
+
+func (t *Truncation) explain(entries []Entry, keep []bool, reasons []TruncationReason) {
+	r := t.resolved()
+	r.keepRules(entries, keep)
+	for i := range keep {
+		if keep[i] {
+			continue
+		}
+		if entries[i].LastUpdate < r.CutBefore {
+			reasons[i] = DroppedByCutBefore
+		} else {
+			reasons[i] = DroppedByCutAboveN
+		}
+	}
+	if r.MaxBytes > 0 {
+		fitBytes(entries, keep, reasons, r.MaxBytes, nil)
+	}
+}
+
+// budgeted is implemented by the policies in this package that keep the
+// entries within a byte budget, so that Pin may account for the entries
+// it preserves on their behalf.
+type budgeted interface {
+	// byteBudget returns the budget, or zero if there is none.
+	byteBudget() int
+}
+
+func (t *Truncation) byteBudget() int {
+	return max(t.MaxBytes, 0)
+}
+
+// fitBytes drops the oldest kept entries for which pinned, if not nil,
+// returns false, until the Bytes representation of the ones left is at
+// most maxBytes long, and records the reason for dropping them in
+// reasons, if not nil.
+func fitBytes(entries []Entry, keep []bool, reasons []TruncationReason, maxBytes int, pinned func(id string) bool) {
+	// Times are only stored if any of the entries has one, so their
+	// size is accounted for separately.
+	size, timesSize, timed := 0, 0, 0
+	for i := range entries {
+		if keep[i] {
+			size += entryBytesSize(entries[i].ID, entries[i].Ticks)
+			timesSize += packedIntSize(entries[i].LastUpdate)
+			if entries[i].LastUpdate > 0 {
+				timed++
+			}
+		}
+	}
+	for i := len(entries) - 1; i >= 0 && bytesSize(size, timesSize, timed) > maxBytes; i-- {
+		if !keep[i] || (pinned != nil && pinned(entries[i].ID)) {
+			continue
+		}
+		keep[i] = false
+		if reasons != nil {
+			reasons[i] = DroppedByMaxBytes
+		}
+		size -= entryBytesSize(entries[i].ID, entries[i].Ticks)
+		timesSize -= packedIntSize(entries[i].LastUpdate)
+		if entries[i].LastUpdate > 0 {
+			timed--
+		}
+	}
+}
+
+// entryBytesSize returns the size of an entry within the Bytes
+// representation of a vector clock, excluding its update time.
+func entryBytesSize(id string, ticks uint64) int {
+	return packedIntSize(ticks) + packedIntSize(uint64(len(id))) + len(id)
+}
+
+// bytesSize returns the size of the Bytes representation of a vector
+// clock with entries taking size bytes, plus timesSize bytes for their
+// update times if timed of them have one.
+func bytesSize(size, timesSize, timed int) int {
+	if size == 0 {
+		return 0
+	}
+	size++ // Space for the header byte.
+	if timed > 0 {
+		size += timesSize
+	}
+	return size
+}
+
+// mayDrop returns whether t might drop any entries of vc. It never
+// returns false when Keep would drop an entry, or when vc exceeds the
+// byte budget of t.
+func (t *Truncation) mayDrop(vc *VClock) bool {
+	if t.KeepAge > 0 || t.CutAge > 0 {
+		r := t.resolved()
+		return r.mayDrop(vc)
+	}
+	if t.MaxBytes > 0 && vc.computeBytesSize() > t.MaxBytes {
+		return true
+	}
+	items := vc.items
+	nitems := len(items)
+	if nitems <= t.KeepMinN {
+		return false
+	}
+	for i := range items {
+		lastUpdate := items[i].lastUpdate
+		if (t.KeepAfter == 0 || lastUpdate < t.KeepAfter) &&
+			(lastUpdate < t.CutBefore || (t.CutAboveN > 0 && nitems > t.CutAboveN)) {
+			return true
+		}
+	}
+	return false
+}
+
+// LRU is a truncation policy that keeps the N most recently updated entries.
+// As with Truncation.CutAboveN, a zero N sets no limit, so LRU{} keeps all
+// entries.
+type LRU struct {
+	N int
+}
+
+// Keep implements the TruncationPolicy interface.
+func (p LRU) Keep(entries []Entry, keep []bool) {
+	for i := 0; i < len(entries) && (p.N == 0 || i < p.N); i++ {
+		keep[i] = true
+	}
+}
+
+func (p LRU) mayDrop(vc *VClock) bool {
+	return p.N > 0 && len(vc.items) > p.N
+}
+
+func (p LRU) explain(entries []Entry, keep []bool, reasons []TruncationReason) {
+	p.Keep(entries, keep)
+	for i := range keep {
+		reasons[i] = DroppedByLRU
+	}
+}
+
+// MaxAge is a truncation policy that keeps the entries last updated at
+// most Age before Now, in the same unit provided to Update.
+type MaxAge struct {
+	Now uint64
+	Age uint64
+}
+
+// Keep implements the TruncationPolicy interface.
+func (p MaxAge) Keep(entries []Entry, keep []bool) {
+	for i := range entries {
+		lastUpdate := entries[i].LastUpdate
+		keep[i] = lastUpdate >= p.Now || p.Now-lastUpdate <= p.Age
+	}
+}
+
+func (p MaxAge) mayDrop(vc *VClock) bool {
+	for i := range vc.items {
+		lastUpdate := vc.items[i].lastUpdate
+		if lastUpdate < p.Now && p.Now-lastUpdate > p.Age {
+			return true
+		}
+	}
+	return false
+}
+
+func (p MaxAge) explain(entries []Entry, keep []bool, reasons []TruncationReason) {
+	p.Keep(entries, keep)
+	for i := range keep {
+		reasons[i] = DroppedByMaxAge
+	}
+}
+
+// And returns a truncation policy that keeps an entry only if all the
+// provided policies keep it. Every policy is consulted with all the
+// entries, so And(LRU{10}, p) keeps the entries kept by p among the 10
+// most recently updated ones. With no policies, all entries are kept.
+func And(policies ...TruncationPolicy) TruncationPolicy {
+	return andPolicy(policies)
+}
+
+// Or returns a truncation policy that keeps an entry if any of the
+// provided policies keep it. With no policies, no entries are kept.
+// Since entries kept by one policy are not accounted for by the others,
+// the result may exceed the Truncation.MaxBytes of any of them.
+func Or(policies ...TruncationPolicy) TruncationPolicy {
+	return orPolicy(policies)
+}
+
+type andPolicy []TruncationPolicy
+
+// byteBudget returns the smallest budget among the policies, as the
+// entries kept by p are kept by each of them.
+func (p andPolicy) byteBudget() (maxBytes int) {
+	for _, policy := range p {
+		if b, ok := policy.(budgeted); ok {
+			if sub := b.byteBudget(); sub > 0 && (maxBytes == 0 || sub < maxBytes) {
+				maxBytes = sub
+			}
+		}
+	}
+	return maxBytes
+}
+
+func (p andPolicy) Keep(entries []Entry, keep []bool) {
+	p.explain(entries, keep, make([]TruncationReason, len(entries)))
+}
+
+func (p andPolicy) mayDrop(vc *VClock) bool {
+	for _, policy := range p {
+		if mayDrop(policy, vc) {
+			return true
+		}
+	}
+	return false
+}
+
+// explain reports each dropped entry with the reason given by the
+// first policy that dropped it.
+func (p andPolicy) explain(entries []Entry, keep []bool, reasons []TruncationReason) {
+	for i := range keep {
+		keep[i] = true
+	}
+	sub := make([]bool, len(entries))
+	subReasons := make([]TruncationReason, len(entries))
+	for _, policy := range p {
+		for i := range sub {
+			sub[i] = false
+		}
+		explain(policy, entries, sub, subReasons)
+		for i := range keep {
+			if keep[i] && !sub[i] {
+				keep[i] = false
+				reasons[i] = subReasons[i]
+			}
+		}
+	}
+}
+
+type orPolicy []TruncationPolicy
+
+func (p orPolicy) Keep(entries []Entry, keep []bool) {
+	p.explain(entries, keep, make([]TruncationReason, len(entries)))
+}
+
+func (p orPolicy) mayDrop(vc *VClock) bool {
+	if len(p) == 0 {
+		return len(vc.items) > 0
+	}
+	for _, policy := range p {
+		if !mayDrop(policy, vc) {
+			return false
+		}
+	}
+	return true
+}
+
+// explain reports each dropped entry with the reason given by the
+// first policy.
+func (p orPolicy) explain(entries []Entry, keep []bool, reasons []TruncationReason) {
+	sub := make([]bool, len(entries))
+	subReasons := make([]TruncationReason, len(entries))
+	for n, policy := range p {
+		for i := range sub {
+			sub[i] = false
+		}
+		explain(policy, entries, sub, subReasons)
+		for i := range keep {
+			keep[i] = keep[i] || sub[i]
+			if n == 0 {
+				reasons[i] = subReasons[i]
+			}
+		}
+	}
+}
+
+// Truncate returns a copy of vc holding only the entries preserved by p.
+// Unless p is a *Truncation that evidently preserves all entries, the
+// entries of the returned clock are ordered from the most to the least
+// recently updated.
+func (vc *VClock) Truncate(p TruncationPolicy) *VClock {
+	truncated := vc.Copy()
+	truncated.TruncateInPlace(p)
+	return truncated
+}
+
+// TruncateInPlace is like Truncate, but drops the entries from vc itself.
+// It does not allocate memory when p is a *Truncation.
+func (vc *VClock) TruncateInPlace(p TruncationPolicy) {
+	if t, ok := p.(*Truncation); ok {
+		r := t.resolved()
+		// As an optimization, check to see if there are items to be removed
+		// before going through the trouble of sorting the items.
+		if r.mayDrop(vc) {
+			vc.sortByAge()
+			vc.dropItems(r.keepItems(vc.items))
+		}
+		return
+	}
+	vc.sortByAge()
+	entries := vc.Entries()
+	keep := make([]bool, len(entries))
+	p.Keep(entries, keep)
+	vc.dropItems(vc.compactItems(keep))
+}
+
+// TruncateWithReport is like Truncate, but also returns the entries
+// dropped from vc, ordered from the most to the least recently updated,
+// along with the rule that dropped each of them.
+func (vc *VClock) TruncateWithReport(p TruncationPolicy) (*VClock, []DroppedEntry) {
+	truncated := vc.Copy()
+	if t, ok := p.(*Truncation); ok {
+		r := t.resolved()
+		if !r.mayDrop(vc) {
+			return truncated, nil
+		}
+		p = &r
+	}
+	truncated.sortByAge()
+	entries := truncated.Entries()
+	keep := make([]bool, len(entries))
+	reasons := make([]TruncationReason, len(entries))
+	explain(p, entries, keep, reasons)
+	var dropped []DroppedEntry
+	for i := range entries {
+		if !keep[i] {
+			dropped = append(dropped, DroppedEntry{entries[i], reasons[i]})
+		}
+	}
+	truncated.dropItems(truncated.compactItems(keep))
+	return truncated, dropped
+}
+
+// sortByAge orders the items of vc from the most to the least recently
+// updated, with ties ordered by id.
+func (vc *VClock) sortByAge() {
+	slices.SortFunc(vc.items, func(a, b itemType) int {
+		if a.lastUpdate != b.lastUpdate {
+			return cmp.Compare(b.lastUpdate, a.lastUpdate)
+		}
+		return strings.Compare(a.id, b.id)
+	})
+}
+
+// compactItems moves the items of vc for which keep is true to the
+// start of vc.items, and the remaining ones after them, and returns the
+// number of the former.
+func (vc *VClock) compactItems(keep []bool) int {
+	kept := 0
+	for i := range vc.items {
+		if keep[i] {
+			vc.items[kept], vc.items[i] = vc.items[i], vc.items[kept]
+			kept++
+		}
+	}
+	return kept
+}
+
+// dropItems drops all but the first n items of vc.
+func (vc *VClock) dropItems(n int) {
+	for i := n; i < len(vc.items); i++ {
+		vc.setPruned(vc.items[i].lastUpdate)
+	}
+	clear(vc.items[n:]) // Release the ids.
+	vc.items = vc.items[:n]
+	// Times are not accounted for by MaxBytes when all zero,
+	// so make sure they aren't stored either.
+	vc.hasUpdateTime = vc.LastUpdate() > 0
+}
+
+// Pin returns a truncation policy that always keeps the entries for the
+// provided ids, and decides on the remaining entries with p. Since p is
+// consulted with the unpinned entries alone, count limits such as LRU.N
+// and Truncation.CutAboveN do not account for pinned entries. When p is
+// a *Truncation, or an And of policies including one, pinned entries do
+// count towards its MaxBytes.
+func Pin(p TruncationPolicy, ids ...string) TruncationPolicy {
+	set := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return &pinPolicy{p, func(id string) bool { return set[id] }}
+}
+
+// PinFunc is like Pin, but keeps the entries for which pinned returns true.
+func PinFunc(p TruncationPolicy, pinned func(id string) bool) TruncationPolicy {
+	return &pinPolicy{p, pinned}
+}
+
+type pinPolicy struct {
+	policy TruncationPolicy
+	pinned func(id string) bool
+}
+
+func (p *pinPolicy) Keep(entries []Entry, keep []bool) {
+	p.explain(entries, keep, make([]TruncationReason, len(entries)))
+}
+
+// mayDrop consults p.policy with all the entries of vc. The policies in
+// this package keep all of the unpinned entries whenever they keep all
+// the entries, and fit them within any byte budget along with the
+// pinned ones.
+func (p *pinPolicy) mayDrop(vc *VClock) bool {
+	return mayDrop(p.policy, vc)
+}
+
+func (p *pinPolicy) explain(entries []Entry, keep []bool, reasons []TruncationReason) {
+	unpinned := make([]Entry, 0, len(entries))
+	index := make([]int, 0, len(entries))
+	for i := range entries {
+		if p.pinned(entries[i].ID) {
+			keep[i] = true
+		} else {
+			unpinned = append(unpinned, entries[i])
+			index = append(index, i)
+		}
+	}
+	sub := make([]bool, len(unpinned))
+	subReasons := make([]TruncationReason, len(unpinned))
+	explain(p.policy, unpinned, sub, subReasons)
+	for j, k := range sub {
+		keep[index[j]] = k
+		reasons[index[j]] = subReasons[j]
+	}
+	if b, ok := p.policy.(budgeted); ok && b.byteBudget() > 0 {
+		// The budget was only applied to the unpinned entries.
+		fitBytes(entries, keep, reasons, b.byteBudget(), p.pinned)
+	}
+}
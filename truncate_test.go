@@ -0,0 +1,347 @@
+package vclock_test
+
+import (
+	"fmt"
+	"github.com/jbondeson/vclock"
+	. "launchpad.net/gocheck"
+	"math/rand"
+	"testing"
+)
+
+type policyTest struct {
+	summary string
+	policy  vclock.TruncationPolicy
+	before  []truncItem
+	after   []truncItem
+}
+
+var policyBefore = []truncItem{{"idA", 1, 2}, {"idB", 2, 5}, {"idC", 1, 3}, {"idD", 1, 5}}
+
+var policyTests = []policyTest{
+	{
+		"Keep all with 'LRU'",
+		vclock.LRU{N: 4},
+		policyBefore,
+		policyBefore,
+	},
+	{
+		"Cut out with 'LRU'",
+		vclock.LRU{N: 3},
+		policyBefore,
+		[]truncItem{{"idB", 2, 5}, {"idC", 1, 3}, {"idD", 1, 5}},
+	},
+	{
+		"Break 'LRU' ties by id",
+		vclock.LRU{N: 1},
+		policyBefore,
+		[]truncItem{{"idB", 2, 5}},
+	},
+	{
+		"Keep all with zero 'LRU'",
+		vclock.LRU{},
+		policyBefore,
+		policyBefore,
+	},
+	{
+		"Cut out with 'MaxAge'",
+		vclock.MaxAge{Now: 6, Age: 3},
+		policyBefore,
+		[]truncItem{{"idB", 2, 5}, {"idC", 1, 3}, {"idD", 1, 5}},
+	},
+	{
+		"Keep future entries with 'MaxAge'",
+		vclock.MaxAge{Now: 4, Age: 0},
+		policyBefore,
+		[]truncItem{{"idB", 2, 5}, {"idD", 1, 5}},
+	},
+	{
+		"Intersect with 'And'",
+		vclock.And(vclock.LRU{N: 3}, vclock.MaxAge{Now: 5, Age: 1}),
+		policyBefore,
+		[]truncItem{{"idB", 2, 5}, {"idD", 1, 5}},
+	},
+	{
+		"Keep all with empty 'And'",
+		vclock.And(),
+		policyBefore,
+		policyBefore,
+	},
+	{
+		"Unite with 'Or'",
+		vclock.Or(vclock.LRU{N: 1}, &vclock.Truncation{CutBefore: 3}),
+		policyBefore,
+		[]truncItem{{"idB", 2, 5}, {"idC", 1, 3}, {"idD", 1, 5}},
+	},
+	{
+		"Cut out everything with empty 'Or'",
+		vclock.Or(),
+		policyBefore,
+		[]truncItem{},
+	},
+	{
+		"Keep entries updated on 'KeepAfter'",
+		&vclock.Truncation{CutAboveN: 1, KeepAfter: 2},
+		[]truncItem{{"idA", 1, 2}, {"idB", 1, 3}},
+		[]truncItem{{"idA", 1, 2}, {"idB", 1, 3}},
+	},
+	{
+		"Do nothing with 'MaxBytes'",
+		&vclock.Truncation{MaxBytes: 25},
+		policyBefore,
+		policyBefore,
+	},
+	{
+		"Cut out with 'MaxBytes'",
+		&vclock.Truncation{MaxBytes: 24},
+		policyBefore,
+		[]truncItem{{"idB", 2, 5}, {"idC", 1, 3}, {"idD", 1, 5}},
+	},
+	{
+		"Cut out with 'MaxBytes' despite 'KeepMinN' and 'KeepAfter'",
+		&vclock.Truncation{MaxBytes: 14, KeepMinN: 4, KeepAfter: 1},
+		policyBefore,
+		[]truncItem{{"idB", 2, 5}, {"idD", 1, 5}},
+	},
+	{
+		"Cut out everything with 'MaxBytes'",
+		&vclock.Truncation{MaxBytes: 1},
+		policyBefore,
+		[]truncItem{},
+	},
+	{
+		"Keep pinned with 'LRU'",
+		vclock.Pin(vclock.LRU{N: 1}, "idA"),
+		policyBefore,
+		[]truncItem{{"idA", 1, 2}, {"idB", 2, 5}},
+	},
+	{
+		"Keep pinned with 'CutBefore'",
+		vclock.Pin(&vclock.Truncation{CutBefore: 10}, "idC", "idX"),
+		policyBefore,
+		[]truncItem{{"idC", 1, 3}},
+	},
+	{
+		"Keep pinned with 'CutAboveN'",
+		vclock.Pin(&vclock.Truncation{CutAboveN: 2}, "idA"),
+		policyBefore,
+		[]truncItem{{"idA", 1, 2}, {"idB", 2, 5}, {"idD", 1, 5}},
+	},
+	{
+		"Keep pinned with empty 'Or'",
+		vclock.PinFunc(vclock.Or(), func(id string) bool { return id < "idC" }),
+		policyBefore,
+		[]truncItem{{"idA", 1, 2}, {"idB", 2, 5}},
+	},
+	{
+		"Count pinned with 'MaxBytes'",
+		vclock.Pin(&vclock.Truncation{MaxBytes: 14}, "idA"),
+		policyBefore,
+		[]truncItem{{"idA", 1, 2}, {"idB", 2, 5}},
+	},
+	{
+		"Keep pinned beyond 'MaxBytes'",
+		vclock.Pin(&vclock.Truncation{MaxBytes: 7}, "idA", "idC"),
+		policyBefore,
+		[]truncItem{{"idA", 1, 2}, {"idC", 1, 3}},
+	},
+	{
+		"Cut out with 'MaxBytes' before the header fits",
+		&vclock.Truncation{MaxBytes: 2},
+		[]truncItem{{"idA", 1, 200}, {"idB", 1, 300}},
+		[]truncItem{},
+	},
+	{
+		"Keep beyond 'MaxBytes' within 'Or'",
+		vclock.Or(vclock.LRU{N: 4}, &vclock.Truncation{MaxBytes: 8}),
+		policyBefore,
+		policyBefore,
+	},
+	{
+		"Count pinned with 'MaxBytes' within 'And'",
+		vclock.Pin(vclock.And(vclock.LRU{N: 3}, &vclock.Truncation{MaxBytes: 14}), "idA"),
+		policyBefore,
+		[]truncItem{{"idA", 1, 2}, {"idB", 2, 5}},
+	},
+	{
+		"Cut out with the smallest 'MaxBytes'",
+		vclock.And(&vclock.Truncation{MaxBytes: 19}, vclock.Pin(&vclock.Truncation{MaxBytes: 8}, "idX")),
+		policyBefore,
+		[]truncItem{{"idB", 2, 5}},
+	},
+}
+
+func (S) TestTruncatePolicy(c *C) {
+	for testN, test := range policyTests {
+		before := newTestClock(test.before)
+		after := newTestClock(test.after)
+		truncated := before.Truncate(test.policy)
+		cmt := Commentf("Policy test %d failed: %s: %v", testN, test.summary, truncated)
+		c.Assert(truncated.Compare(after, vclock.Equal), Equals, true, cmt)
+		c.Assert(truncated.Len(), Equals, len(test.after), cmt)
+		c.Assert(before.Compare(newTestClock(test.before), vclock.Equal), Equals, true, cmt)
+	}
+}
+
+func (S) TestTruncateOrder(c *C) {
+	vc := newTestClock([]truncItem{{"idA", 1, 2}, {"idB", 1, 3}, {"idC", 1, 3}})
+	c.Assert(vc.Truncate(vclock.LRU{N: 2}).Entries(), DeepEquals, []vclock.Entry{
+		{ID: "idB", Ticks: 1, LastUpdate: 3},
+		{ID: "idC", Ticks: 1, LastUpdate: 3},
+	})
+	c.Assert(vc.Truncate(vclock.LRU{N: 3}).Entries(), DeepEquals, []vclock.Entry{
+		{ID: "idB", Ticks: 1, LastUpdate: 3},
+		{ID: "idC", Ticks: 1, LastUpdate: 3},
+		{ID: "idA", Ticks: 1, LastUpdate: 2},
+	})
+	// Evidently nothing to drop, so the original order is preserved.
+	c.Assert(vc.Truncate(&vclock.Truncation{CutBefore: 2}).Entries(), DeepEquals, vc.Entries())
+}
+
+type recordPolicy struct {
+	entries []vclock.Entry
+}
+
+func (p *recordPolicy) Keep(entries []vclock.Entry, keep []bool) {
+	p.entries = append([]vclock.Entry(nil), entries...)
+	for i := range keep {
+		keep[i] = true
+	}
+}
+
+func (S) TestTruncateCustomPolicy(c *C) {
+	vc := newTestClock([]truncItem{{"idC", 1, 1}, {"idB", 2, 3}, {"idA", 1, 3}})
+	policy := &recordPolicy{}
+	truncated := vc.Truncate(policy)
+	c.Assert(truncated.Compare(vc, vclock.Equal), Equals, true)
+	c.Assert(policy.entries, DeepEquals, []vclock.Entry{
+		{ID: "idA", Ticks: 1, LastUpdate: 3},
+		{ID: "idB", Ticks: 2, LastUpdate: 3},
+		{ID: "idC", Ticks: 1, LastUpdate: 1},
+	})
+}
+
+func (S) TestTruncateWithReport(c *C) {
+	vc := newTestClock([]truncItem{{"idA", 1, 2}, {"idB", 2, 5}, {"idC", 1, 3}, {"idD", 1, 4}, {"idE", 1, 6}})
+	truncated, dropped := vc.TruncateWithReport(&vclock.Truncation{CutAboveN: 3, CutBefore: 3})
+	c.Assert(truncated.Compare(vc.Truncate(&vclock.Truncation{CutAboveN: 3, CutBefore: 3}), vclock.Equal), Equals, true)
+	c.Assert(dropped, DeepEquals, []vclock.DroppedEntry{
+		{vclock.Entry{ID: "idC", Ticks: 1, LastUpdate: 3}, vclock.DroppedByCutAboveN},
+		{vclock.Entry{ID: "idA", Ticks: 1, LastUpdate: 2}, vclock.DroppedByCutBefore},
+	})
+
+	truncated, dropped = vc.TruncateWithReport(&vclock.Truncation{CutAboveN: 5})
+	c.Assert(truncated.Compare(vc, vclock.Equal), Equals, true)
+	c.Assert(dropped, IsNil)
+}
+
+// randomTestClock returns a clock with a few random ids, most of them
+// updated at random times below 1<<timeBits.
+func randomTestClock(rnd *rand.Rand, timeBits int) *vclock.VClock {
+	vc := vclock.New()
+	for i := rnd.Intn(20); i != 0; i-- {
+		id := fmt.Sprintf("node-%d", rnd.Intn(1000))
+		when := uint64(0)
+		if rnd.Intn(4) != 0 {
+			when = uint64(rnd.Int63n(1 << uint(rnd.Intn(timeBits))))
+		}
+		for j := rnd.Intn(3); j >= 0; j-- {
+			vc.Update(id, when)
+		}
+	}
+	return vc
+}
+
+func (S) TestTruncateMaxBytes(c *C) {
+	rnd := rand.New(rand.NewSource(42))
+	for n := 0; n != 200; n++ {
+		vc := randomTestClock(rnd, 40)
+		maxBytes := 1 + rnd.Intn(100)
+		truncated, dropped := vc.TruncateWithReport(&vclock.Truncation{MaxBytes: maxBytes})
+		cmt := Commentf("%v with MaxBytes %d: %v", vc, maxBytes, truncated)
+		c.Assert(len(truncated.Bytes()) <= maxBytes, Equals, true, cmt)
+		c.Assert(truncated.Len()+len(dropped), Equals, vc.Len(), cmt)
+		if len(dropped) > 0 {
+			// Keeping the newest of the dropped entries must exceed the budget.
+			restored := vclock.FromEntries(append(truncated.Entries(), dropped[0].Entry))
+			c.Assert(len(restored.Bytes()) > maxBytes, Equals, true, cmt)
+			c.Assert(dropped[0].Reason, Equals, vclock.DroppedByMaxBytes)
+		}
+	}
+}
+
+func (S) TestTruncateMaxBytesZeroTimes(c *C) {
+	vc, err := vclock.FromBytes([]byte{1, 1, 0, 3, 'i', 'd', 'A'})
+	c.Assert(err, IsNil)
+	truncated := vc.Truncate(&vclock.Truncation{MaxBytes: 6})
+	c.Assert(truncated.Bytes(), DeepEquals, []byte{0, 1, 3, 'i', 'd', 'A'})
+}
+
+func (S) TestTruncateInPlace(c *C) {
+	rnd := rand.New(rand.NewSource(42))
+	for n := 0; n != 500; n++ {
+		vc := randomTestClock(rnd, 5)
+		t := &vclock.Truncation{
+			KeepMinN:  rnd.Intn(5),
+			KeepAfter: uint64(rnd.Intn(40)),
+			CutAboveN: rnd.Intn(12),
+			CutBefore: uint64(rnd.Intn(30)),
+			MaxBytes:  rnd.Intn(3) * rnd.Intn(150),
+		}
+		for _, policy := range []vclock.TruncationPolicy{t, vclock.LRU{N: t.CutAboveN}, vclock.Pin(t, "node-1")} {
+			truncated := vc.Truncate(policy)
+			reported, _ := vc.TruncateWithReport(policy)
+			inPlace := vc.Copy()
+			inPlace.TruncateInPlace(policy)
+			cmt := Commentf("%#v with %#v", vc, policy)
+			c.Assert(inPlace.Entries(), DeepEquals, truncated.Entries(), cmt)
+			c.Assert(inPlace.Bytes(), DeepEquals, truncated.Bytes(), cmt)
+			c.Assert(reported.Bytes(), DeepEquals, truncated.Bytes(), cmt)
+		}
+	}
+}
+
+func (S) TestTruncateInPlaceAllocs(c *C) {
+	vc := vclock.New()
+	for i := 0; i != 100; i++ {
+		vc.Update(fmt.Sprintf("node-%d", i), uint64(i%17))
+	}
+	t := &vclock.Truncation{KeepMinN: 10, CutAboveN: 50, CutBefore: 8, MaxBytes: 500}
+	var work *vclock.VClock
+	copyAllocs := testing.AllocsPerRun(100, func() {
+		work = vc.Copy()
+	})
+	allocs := testing.AllocsPerRun(100, func() {
+		work = vc.Copy()
+		work.TruncateInPlace(t)
+	})
+	c.Assert(allocs, Equals, copyAllocs)
+	c.Assert(work.Len() < vc.Len(), Equals, true)
+	c.Assert(work.Entries(), DeepEquals, vc.Truncate(t).Entries())
+}
+
+func (S) TestTruncateWithReportComposite(c *C) {
+	vc := newTestClock([]truncItem{{"idA", 1, 2}, {"idB", 2, 5}, {"idC", 1, 3}, {"idD", 1, 4}})
+	policy := vclock.Pin(vclock.And(vclock.MaxAge{Now: 5, Age: 2}, vclock.LRU{N: 1}, &recordPolicy{}), "idC")
+	_, dropped := vc.TruncateWithReport(policy)
+	c.Assert(dropped, DeepEquals, []vclock.DroppedEntry{
+		{vclock.Entry{ID: "idD", Ticks: 1, LastUpdate: 4}, vclock.DroppedByLRU},
+		{vclock.Entry{ID: "idA", Ticks: 1, LastUpdate: 2}, vclock.DroppedByMaxAge},
+	})
+
+	_, dropped = vc.TruncateWithReport(vclock.Or(&vclock.Truncation{MaxBytes: 8}, vclock.LRU{N: 2}))
+	c.Assert(dropped, DeepEquals, []vclock.DroppedEntry{
+		{vclock.Entry{ID: "idC", Ticks: 1, LastUpdate: 3}, vclock.DroppedByMaxBytes},
+		{vclock.Entry{ID: "idA", Ticks: 1, LastUpdate: 2}, vclock.DroppedByMaxBytes},
+	})
+
+	_, dropped = vc.TruncateWithReport(vclock.Or(dropAll{}, vclock.LRU{N: 1}))
+	c.Assert(dropped, HasLen, 3)
+	for _, d := range dropped {
+		c.Assert(d.Reason, Equals, vclock.DroppedByPolicy)
+		c.Assert(d.Reason.String(), Equals, "policy")
+	}
+}
+
+type dropAll struct{}
+
+func (dropAll) Keep(entries []vclock.Entry, keep []bool) {}
@@ -34,10 +34,11 @@
 package vclock
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
-	"math"
 	"sort"
+	"unicode/utf8"
 )
 
 // Condition constants define how to compare a vector clock against another,
@@ -57,10 +58,34 @@ type itemType struct {
 	lastUpdate uint64
 }
 
+// JSONFormat defines how a vector clock is represented by MarshalJSON.
+type JSONFormat int
+
+const (
+	// JSONBytes marshals the clock as a base64 string of its Bytes
+	// representation. This is the default.
+	JSONBytes JSONFormat = iota
+	// JSONObject marshals the clock as an object mapping each id to its
+	// ticks and update time, as in {"idA":{"ticks":3,"lastUpdate":17}}.
+	JSONObject
+	// JSONCompact marshals the clock as an object mapping each id to its
+	// ticks alone, as in {"idA":3}. Update times are lost.
+	//
+	// Both object formats fail to marshal clocks with ids that are not
+	// valid UTF-8, which JSON strings cannot hold.
+	JSONCompact
+)
+
 // VClock represents a vector clock.
 type VClock struct {
 	hasUpdateTime bool
+	jsonFormat    JSONFormat
 	items         []itemType
+
+	// pruned is set once truncation drops entries, and watermark holds
+	// the most recent update time of the dropped entries.
+	pruned    bool
+	watermark uint64
 }
 
 // findItem finds the index for the item with the given id.
@@ -106,15 +131,49 @@ func New() *VClock {
 
 // Copy returns a copy of vc.
 func (vc *VClock) Copy() *VClock {
-	other := New()
+	other := *vc
 	other.items = make([]itemType, len(vc.items))
 	copy(other.items, vc.items)
-	return other
+	return &other
+}
+
+// Entry holds the clock ticks of a single id within a vector clock,
+// and the time of its most recent update.
+type Entry struct {
+	ID         string
+	Ticks      uint64
+	LastUpdate uint64
+}
+
+// FromEntries returns a vector clock holding the provided entries.
+// The ticks of entries sharing the same id are added together.
+func FromEntries(entries []Entry) *VClock {
+	vc := New()
+	vc.items = make([]itemType, 0, len(entries))
+	for _, e := range entries {
+		vc.updateItem(e.ID, e.Ticks, e.LastUpdate)
+	}
+	return vc
+}
+
+// Entries returns a copy of the entries held by vc.
+func (vc *VClock) Entries() []Entry {
+	entries := make([]Entry, len(vc.items))
+	for i := range vc.items {
+		entries[i] = Entry{vc.items[i].id, vc.items[i].ticks, vc.items[i].lastUpdate}
+	}
+	return entries
+}
+
+// Len returns the number of ids known to vc.
+func (vc *VClock) Len() int {
+	return len(vc.items)
 }
 
 // Update increments id's clock ticks in vc. The when update time is associated
 // with id and may be used for pruning the vector clock. It may have any unit,
-// but smaller values are represented in shorter space.
+// but smaller values are represented in shorter space. See UpdateNow and
+// Timebase for deriving it from wall-clock time.
 func (vc *VClock) Update(id string, when uint64) {
 	vc.updateItem(id, 1, when)
 }
@@ -130,6 +189,60 @@ func (vc *VClock) LastUpdate() (last uint64) {
 	return last
 }
 
+// ChangedSince returns the entries of vc last updated after t, ordered
+// from the most to the least recently updated, with ties ordered by id.
+func (vc *VClock) ChangedSince(t uint64) []Entry {
+	return vc.entriesWhere(func(lastUpdate uint64) bool { return lastUpdate > t })
+}
+
+// StaleBefore returns the entries of vc last updated before t, ordered
+// as in ChangedSince. Entries without an update time are considered to
+// have been updated at zero.
+func (vc *VClock) StaleBefore(t uint64) []Entry {
+	return vc.entriesWhere(func(lastUpdate uint64) bool { return lastUpdate < t })
+}
+
+func (vc *VClock) entriesWhere(match func(lastUpdate uint64) bool) []Entry {
+	var matched VClock
+	for i := range vc.items {
+		if match(vc.items[i].lastUpdate) {
+			matched.items = append(matched.items, vc.items[i])
+		}
+	}
+	matched.sortByAge()
+	return matched.Entries()
+}
+
+// OldestEntry returns the entry of vc with the least recent update time,
+// with ties resolved in favor of the lowest id. It returns false if vc
+// is empty.
+func (vc *VClock) OldestEntry() (Entry, bool) {
+	return vc.entryWhere(func(a, b *itemType) bool { return a.lastUpdate < b.lastUpdate })
+}
+
+// NewestEntry returns the entry of vc with the most recent update time,
+// with ties resolved in favor of the lowest id. It returns false if vc
+// is empty.
+func (vc *VClock) NewestEntry() (Entry, bool) {
+	return vc.entryWhere(func(a, b *itemType) bool { return a.lastUpdate > b.lastUpdate })
+}
+
+// entryWhere returns the item of vc that is before all others according
+// to before, or to the order of ids when before doesn't tell.
+func (vc *VClock) entryWhere(before func(a, b *itemType) bool) (Entry, bool) {
+	if len(vc.items) == 0 {
+		return Entry{}, false
+	}
+	best := &vc.items[0]
+	for i := 1; i < len(vc.items); i++ {
+		item := &vc.items[i]
+		if before(item, best) || !before(best, item) && item.id < best.id {
+			best = item
+		}
+	}
+	return Entry{best.id, best.ticks, best.lastUpdate}, true
+}
+
 // Compare returns whether other matches any one of the conditions ORed
 // together within cond (Equal, Ancestor, Descendant, or Concurrent).
 func (vc *VClock) Compare(other *VClock, cond Condition) bool {
@@ -161,7 +274,8 @@ func (vc *VClock) Compare(other *VClock, cond Condition) bool {
 			vcTicks := vc.items[vci].ticks
 			if otherTicks > vcTicks {
 				if otherIs == Equal {
-					if cond&Descendant == 0 {
+					// Other may still turn out to be concurrent.
+					if cond&(Descendant|Concurrent) == 0 {
 						return false
 					}
 					otherIs = Descendant
@@ -170,7 +284,7 @@ func (vc *VClock) Compare(other *VClock, cond Condition) bool {
 				}
 			} else if otherTicks < vcTicks {
 				if otherIs == Equal {
-					if cond&Ancestor == 0 {
+					if cond&(Ancestor|Concurrent) == 0 {
 						return false
 					}
 					otherIs = Ancestor
@@ -195,15 +309,19 @@ func (vc *VClock) Compare(other *VClock, cond Condition) bool {
 
 // Merge merges other into vc, so that vc becomes a descendant of other.
 // This means that every clock tick in other which doesn't exist in vc
-// or which is smaller in vc will be copied from other to vc.
+// or which is smaller in vc will be copied from other to vc, and so will
+// any more recent update time.
 func (vc *VClock) Merge(other *VClock) {
 	appends := 0
 	for oi := range other.items {
-		// First pass, updating old tickss and counting missing items.
+		// First pass, updating old ticks and counting missing items.
 		if vci, found := vc.findItem(other.items[oi].id); found {
 			if vc.items[vci].ticks < other.items[oi].ticks {
 				vc.items[vci].ticks = other.items[oi].ticks
 			}
+			if vc.items[vci].lastUpdate < other.items[oi].lastUpdate {
+				vc.items[vci].lastUpdate = other.items[oi].lastUpdate
+			}
 		} else {
 			appends += 1
 		}
@@ -211,17 +329,22 @@ func (vc *VClock) Merge(other *VClock) {
 
 	if appends > 0 {
 		// Second pass, now appending the missing ones.
-		pos := len(vc.items)
-		items := make([]itemType, len(vc.items)+1)
+		nitems := len(vc.items)
+		items := make([]itemType, nitems, nitems+appends)
 		copy(items, vc.items)
 		vc.items = items
 		for oi := range other.items {
 			if _, found := vc.findItem(other.items[oi].id); !found {
-				vc.items[pos].id = other.items[oi].id
-				vc.items[pos].ticks = other.items[oi].ticks
+				vc.items = append(vc.items, other.items[oi])
 			}
 		}
 	}
+	if other.hasUpdateTime {
+		vc.hasUpdateTime = true
+	}
+	if other.pruned {
+		vc.setPruned(other.watermark)
+	}
 }
 
 // Bytes returns the serialized representation of vc.
@@ -230,22 +353,31 @@ func (vc *VClock) Bytes() []byte {
 	if len(vc.items) == 0 {
 		return []byte{}
 	}
-	resultSize := vc.computeBytesSize()
-	result := make([]byte, resultSize)
+	result := make([]byte, vc.computeBytesSize())
+	vc.putBytes(result)
+	return result
+}
+
+// putBytes serializes vc into out, which must have been sized
+// according to computeBytesSize.
+func (vc *VClock) putBytes(out []byte) {
+	if len(vc.items) == 0 {
+		return
+	}
+	out[0] = 0
 	if vc.hasUpdateTime {
-		result[0] |= 0x1 // We'll store times too.
+		out[0] |= 0x1 // We'll store times too.
 	}
-	pos := 1 // result[0] is header byte.
+	pos := 1 // out[0] is header byte.
 	for i := range vc.items {
-		pos += packInt(vc.items[i].ticks, result[pos:])
+		pos += packInt(vc.items[i].ticks, out[pos:])
 		if vc.hasUpdateTime {
-			pos += packInt(vc.items[i].lastUpdate, result[pos:])
+			pos += packInt(vc.items[i].lastUpdate, out[pos:])
 		}
-		pos += packInt(uint64(len(vc.items[i].id)), result[pos:])
-		copy(result[pos:], vc.items[i].id)
+		pos += packInt(uint64(len(vc.items[i].id)), out[pos:])
+		copy(out[pos:], vc.items[i].id)
 		pos += len(vc.items[i].id)
 	}
-	return result
 }
 
 // FromBytes returns the vector clock represented by the provided data,
@@ -287,7 +419,7 @@ func (vc *VClock) fromBytes(data []byte) (err error) {
 		}
 		idLen, size, ok := unpackInt(data[pos:])
 		pos += size
-		if !ok || (pos+int(idLen)) > len(data) {
+		if !ok || idLen > uint64(len(data)-pos) {
 			return errors.New("bad vclock id")
 		}
 		id := data[pos : pos+int(idLen)]
@@ -344,98 +476,124 @@ func unpackInt(in []byte) (value uint64, size int, ok bool) {
 // packedIntSize returned the number of bytes used when value is
 // packed via packInt.
 func packedIntSize(value uint64) int {
-	if value < 128 {
-		return 1
-	}
-	return int(math.Ceil(math.Log2(float64(value+1)) / 7))
-}
-
-// Truncation defines a truncation strategy for use with Truncate.
-type Truncation struct {
-	// If the number of entries in the vector clock is <= KeepMinN or all the
-	// remaining entries were updated on or after KeepAfter, truncation stops.
-	// Otherwise, the oldest entries last updated prior to CutBefore, or getting
-	// the vc above CutAboveN entries are dropped.
-	KeepMinN  int
-	KeepAfter uint64
-	CutAboveN int
-	CutBefore uint64
-}
-
-// Truncate vc using the rules defined by t.
-func (vc *VClock) Truncate(t *Truncation) *VClock {
-	// As an optimization, check to see if there are items to be removed
-	// before going through the trouble of rebuilding the truncated VClock.
-	nitems := len(vc.items)
-	if nitems > t.KeepMinN {
-		for i := 0; i != nitems; i++ {
-			item := &vc.items[i]
-			if (t.KeepAfter == 0 || item.lastUpdate < t.KeepAfter) && (item.lastUpdate < t.CutBefore || nitems > t.CutAboveN) {
-				// There are items to be removed.
-				return vc.actuallyTruncate(t)
-			}
-		}
-	}
-	// Nothing to do with vc.
-	return vc.Copy()
-}
-
-func (vc *VClock) actuallyTruncate(t *Truncation) *VClock {
-	items := sortItems(vc)
-	truncated := New()
-	truncated.items = make([]itemType, 0, len(vc.items)) // Pre-allocate all.
-	for _, item := range items {
-		if len(truncated.items) < t.KeepMinN ||
-			(t.KeepAfter > 0 && item.lastUpdate > t.KeepAfter) ||
-			((t.CutAboveN == 0 || len(truncated.items) < t.CutAboveN) && (item.lastUpdate >= t.CutBefore)) {
-			truncated.updateItem(item.id, item.ticks, item.lastUpdate)
-		}
-	}
-	return truncated
-}
-
-func sortItems(vc *VClock) []*itemType {
-	items := make([]*itemType, len(vc.items))
-	for i := 0; i != len(vc.items); i++ {
-		items[i] = &vc.items[i]
+	size := 1
+	for value >= 128 {
+		value >>= 7
+		size++
 	}
-	sorter := itemSorter{items}
-	sort.Sort(&sorter)
-	return items
-}
-
-type itemSorter struct {
-	items []*itemType
-}
-
-func (sorter *itemSorter) Len() int {
-	return len(sorter.items)
+	return size
 }
 
-func (sorter *itemSorter) Less(i, j int) bool {
-	// Inverted. We want greater items first.
-	return sorter.items[i].lastUpdate > sorter.items[j].lastUpdate
+// SetJSONFormat defines how vc is represented by MarshalJSON.
+// UnmarshalJSON accepts any of the formats regardless of this setting,
+// and sets it to the format found in the input.
+func (vc *VClock) SetJSONFormat(format JSONFormat) {
+	vc.jsonFormat = format
 }
 
-func (sorter *itemSorter) Swap(i, j int) {
-	sorter.items[i], sorter.items[j] = sorter.items[j], sorter.items[i]
+type jsonItem struct {
+	Ticks      uint64 `json:"ticks"`
+	LastUpdate uint64 `json:"lastUpdate,omitempty"`
 }
 
 // encoding/json.Marshaler interface
 func (vc *VClock) MarshalJSON() ([]byte, error) {
+	return vc.marshalJSON(vc.jsonFormat)
+}
+
+func (vc *VClock) marshalJSON(format JSONFormat) ([]byte, error) {
+	if format == JSONObject || format == JSONCompact {
+		// Invalid bytes would be replaced within JSON strings.
+		for i := range vc.items {
+			if !utf8.ValidString(vc.items[i].id) {
+				return nil, errors.New("vclock id is not valid UTF-8")
+			}
+		}
+	}
+	switch format {
+	case JSONObject:
+		items := make(map[string]jsonItem, len(vc.items))
+		for i := range vc.items {
+			items[vc.items[i].id] = jsonItem{vc.items[i].ticks, vc.items[i].lastUpdate}
+		}
+		return json.Marshal(items)
+	case JSONCompact:
+		items := make(map[string]uint64, len(vc.items))
+		for i := range vc.items {
+			items[vc.items[i].id] = vc.items[i].ticks
+		}
+		return json.Marshal(items)
+	}
 	return json.Marshal(vc.Bytes())
 }
 
 // encoding/json.Unmarshaler interface
+//
+// Both the legacy base64 string and the object formats are accepted.
+// Any entries previously held by vc are discarded.
 func (vc *VClock) UnmarshalJSON(b []byte) (err error) {
-	var data []byte
-	err = json.Unmarshal(b, &data)
-
+	b = bytes.TrimSpace(b)
+	if bytes.Equal(b, []byte("null")) {
+		return nil
+	}
+	decoded := New()
+	if len(b) > 0 && b[0] == '{' {
+		err = decoded.fromJSONObject(b)
+	} else {
+		var data []byte
+		err = json.Unmarshal(b, &data)
+		if err == nil {
+			err = decoded.fromBytes(data)
+		}
+	}
 	if err != nil {
-		return
+		return err
 	}
+	*vc = *decoded
+	return nil
+}
 
-	err = vc.fromBytes(data)
+func (vc *VClock) fromJSONObject(b []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	ids := make([]string, 0, len(raw))
+	for id := range raw {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	vc.jsonFormat = JSONObject
+	for _, id := range ids {
+		var item jsonItem
+		value := bytes.TrimSpace(raw[id])
+		if len(value) > 0 && value[0] == '{' {
+			if err := json.Unmarshal(value, &item); err != nil {
+				return err
+			}
+		} else if err := json.Unmarshal(value, &item.Ticks); err != nil {
+			return err
+		} else {
+			vc.jsonFormat = JSONCompact
+		}
+		vc.updateItem(id, item.Ticks, item.LastUpdate)
+	}
+	return nil
+}
 
-	return
+// encoding/gob.GobEncoder interface
+func (vc *VClock) GobEncode() ([]byte, error) {
+	return vc.Bytes(), nil
+}
+
+// encoding/gob.GobDecoder interface
+//
+// Any entries previously held by vc are discarded.
+func (vc *VClock) GobDecode(data []byte) error {
+	decoded := New()
+	if err := decoded.fromBytes(data); err != nil {
+		return err
+	}
+	*vc = *decoded
+	return nil
 }
@@ -2,9 +2,11 @@ package vclock_test
 
 import (
 	"bytes"
+	"encoding/gob"
 	"encoding/json"
 	"github.com/jbondeson/vclock"
 	. "launchpad.net/gocheck"
+	"math"
 	"testing"
 )
 
@@ -87,6 +89,22 @@ func (S) TestCompareWithMissingInOther(c *C) {
 	c.Assert(vc2.Compare(vc1, vclock.Concurrent), Equals, true)
 }
 
+func (S) TestCompareConcurrentWithSameLength(c *C) {
+	vc1 := vclock.New()
+	vc1.Update("idA", 0)
+	vc1.Update("idB", 0)
+	vc2 := vc1.Copy()
+	vc1.Update("idB", 0)
+	vc2.Update("idA", 0)
+	for _, pair := range [][2]*vclock.VClock{{vc1, vc2}, {vc2, vc1}} {
+		c.Assert(pair[0].Compare(pair[1], vclock.Equal), Equals, false)
+		c.Assert(pair[0].Compare(pair[1], vclock.Ancestor), Equals, false)
+		c.Assert(pair[0].Compare(pair[1], vclock.Descendant), Equals, false)
+		c.Assert(pair[0].Compare(pair[1], vclock.Concurrent), Equals, true)
+		c.Assert(pair[0].Compare(pair[1], ^vclock.Concurrent), Equals, false)
+	}
+}
+
 func (S) TestMerge(c *C) {
 	vc1 := vclock.New()
 	vc2 := vclock.New()
@@ -106,6 +124,64 @@ func (S) TestMerge(c *C) {
 	c.Assert(vc2.Compare(vc1, vclock.Equal), Equals, true)
 }
 
+func (S) TestMergeManyMissing(c *C) {
+	vc1 := vclock.New()
+	vc1.Update("idA", 3)
+	vc1.Update("idB", 2)
+	vc1.Update("idC", 0)
+	vc2 := vclock.New()
+	vc2.Update("idA", 1)
+	vc2.Update("idA", 1)
+
+	vc2.Merge(vc1)
+
+	c.Assert(vc2.Entries(), DeepEquals, []vclock.Entry{
+		{ID: "idA", Ticks: 2, LastUpdate: 3},
+		{ID: "idB", Ticks: 1, LastUpdate: 2},
+		{ID: "idC", Ticks: 1, LastUpdate: 0},
+	})
+	c.Assert(vc2.Compare(vc1, vclock.Ancestor), Equals, true)
+
+	vc3 := vclock.New()
+	vc3.Merge(vc1)
+	c.Assert(vc3.Bytes(), DeepEquals, vc1.Bytes())
+}
+
+func (S) TestChangedSinceAndStaleBefore(c *C) {
+	vc := newTestClock([]truncItem{{"idA", 1, 5}, {"idB", 2, 0}, {"idC", 1, 9}, {"idD", 1, 5}})
+	c.Assert(vc.ChangedSince(4), DeepEquals, []vclock.Entry{
+		{ID: "idC", Ticks: 1, LastUpdate: 9},
+		{ID: "idA", Ticks: 1, LastUpdate: 5},
+		{ID: "idD", Ticks: 1, LastUpdate: 5},
+	})
+	c.Assert(vc.ChangedSince(5), DeepEquals, []vclock.Entry{{ID: "idC", Ticks: 1, LastUpdate: 9}})
+	c.Assert(vc.ChangedSince(9), HasLen, 0)
+	c.Assert(vc.StaleBefore(9), DeepEquals, []vclock.Entry{
+		{ID: "idA", Ticks: 1, LastUpdate: 5},
+		{ID: "idD", Ticks: 1, LastUpdate: 5},
+		{ID: "idB", Ticks: 2, LastUpdate: 0},
+	})
+	c.Assert(vc.StaleBefore(0), HasLen, 0)
+	c.Assert(vc.Len(), Equals, 4)
+}
+
+func (S) TestOldestAndNewestEntry(c *C) {
+	vc := vclock.New()
+	_, ok := vc.OldestEntry()
+	c.Assert(ok, Equals, false)
+	_, ok = vc.NewestEntry()
+	c.Assert(ok, Equals, false)
+
+	vc = newTestClock([]truncItem{{"idD", 1, 5}, {"idC", 1, 9}, {"idB", 2, 1}, {"idA", 1, 9}, {"idE", 1, 1}})
+	oldest, ok := vc.OldestEntry()
+	c.Assert(ok, Equals, true)
+	c.Assert(oldest, Equals, vclock.Entry{ID: "idB", Ticks: 2, LastUpdate: 1})
+	newest, ok := vc.NewestEntry()
+	c.Assert(ok, Equals, true)
+	c.Assert(newest, Equals, vclock.Entry{ID: "idA", Ticks: 1, LastUpdate: 9})
+	c.Assert(newest.LastUpdate, Equals, vc.LastUpdate())
+}
+
 func (S) TestCopy(c *C) {
 	vc1 := vclock.New()
 	vc1.Update("idA", 0)
@@ -204,6 +280,18 @@ func (S) TestBytesWithTime(c *C) {
 	testFromBytes(c, vc)
 }
 
+func (S) TestBytesLargeValues(c *C) {
+	vc := vclock.FromEntries([]vclock.Entry{{ID: "idA", Ticks: 1 << 56, LastUpdate: math.MaxUint64}})
+	c.Assert(vc.Bytes(), DeepEquals, []byte{
+		1,
+		129, 128, 128, 128, 128, 128, 128, 128, 0, // 2^56 takes 57 bits.
+		129, 255, 255, 255, 255, 255, 255, 255, 255, 127, // MaxUint64 takes 64 bits.
+		3, 'i', 'd', 'A',
+	})
+	testFromBytes(c, vc)
+	c.Assert(vclock.FromEntries([]vclock.Entry{{ID: "idA", Ticks: 1<<56 - 1}}).Bytes(), HasLen, 1+8+4)
+}
+
 type fromBytesTest struct {
 	header byte
 	suffix []byte
@@ -257,6 +345,16 @@ type truncItem struct {
 	time    uint64
 }
 
+func newTestClock(items []truncItem) *vclock.VClock {
+	vc := vclock.New()
+	for _, item := range items {
+		for j := 0; j != item.updates; j++ {
+			vc.Update(item.id, item.time)
+		}
+	}
+	return vc
+}
+
 type truncTest struct {
 	summary string
 	trunc   vclock.Truncation
@@ -339,7 +437,7 @@ func (s *S) TestTruncate(c *C) {
 			}
 		}
 		truncated := before.Truncate(&test.trunc)
-		cmt := Commentf("Truncation test %d failed: %s: %#v", testN, test.summary, truncated.Bytes())
+		cmt := Commentf("Truncation test %d failed: %s: %v", testN, test.summary, truncated)
 		c.Assert(truncated.Compare(after, vclock.Equal), Equals, true, cmt)
 	}
 }
@@ -355,3 +453,147 @@ func (s *S) TestJson(c *C) {
 
 	c.Assert(vc1, DeepEquals, vc2)
 }
+
+func (s *S) TestJsonObject(c *C) {
+	vc1 := vclock.New()
+	vc1.Update("idA", 5)
+	vc1.Update("idA", 17)
+	vc1.Update("idB", 0)
+	vc1.SetJSONFormat(vclock.JSONObject)
+
+	j1, err := json.Marshal(vc1)
+	c.Assert(err, IsNil)
+	c.Assert(string(j1), Equals, `{"idA":{"ticks":2,"lastUpdate":17},"idB":{"ticks":1}}`)
+
+	var vc2 *vclock.VClock
+	err = json.Unmarshal(j1, &vc2)
+	c.Assert(err, IsNil)
+	c.Assert(vc2, DeepEquals, vc1)
+}
+
+func (s *S) TestJsonCompact(c *C) {
+	vc1 := vclock.New()
+	vc1.Update("idA", 0)
+	vc1.Update("idA", 0)
+	vc1.Update("idB", 0)
+	vc1.SetJSONFormat(vclock.JSONCompact)
+
+	j1, err := json.Marshal(vc1)
+	c.Assert(err, IsNil)
+	c.Assert(string(j1), Equals, `{"idA":2,"idB":1}`)
+
+	var vc2 *vclock.VClock
+	err = json.Unmarshal(j1, &vc2)
+	c.Assert(err, IsNil)
+	c.Assert(vc2, DeepEquals, vc1)
+}
+
+func (s *S) TestJsonInvalidUTF8(c *C) {
+	vc1 := vclock.New()
+	vc1.Update("\xff\xfe", 1)
+	for _, format := range []vclock.JSONFormat{vclock.JSONObject, vclock.JSONCompact} {
+		vc1.SetJSONFormat(format)
+		_, err := json.Marshal(vc1)
+		c.Assert(err, ErrorMatches, ".*vclock id is not valid UTF-8")
+	}
+
+	vc1.SetJSONFormat(vclock.JSONBytes)
+	j1, err := json.Marshal(vc1)
+	c.Assert(err, IsNil)
+	var vc2 *vclock.VClock
+	err = json.Unmarshal(j1, &vc2)
+	c.Assert(err, IsNil)
+	c.Assert(vc2.Entries()[0].ID, Equals, "\xff\xfe")
+}
+
+func (s *S) TestJsonEmbedded(c *C) {
+	type object struct {
+		Version *vclock.VClock `json:"version"`
+	}
+	vc1 := vclock.New()
+	vc1.Update("idA", 3)
+	vc1.SetJSONFormat(vclock.JSONObject)
+
+	j1, err := json.Marshal(object{vc1})
+	c.Assert(err, IsNil)
+	c.Assert(string(j1), Equals, `{"version":{"idA":{"ticks":1,"lastUpdate":3}}}`)
+
+	var obj object
+	err = json.Unmarshal([]byte(`{"version": {"idA": 1, "idB": {"ticks": 2}}}`), &obj)
+	c.Assert(err, IsNil)
+	vc2 := vclock.New()
+	vc2.Update("idA", 0)
+	vc2.Update("idB", 0)
+	vc2.Update("idB", 0)
+	c.Assert(obj.Version.Compare(vc2, vclock.Equal), Equals, true)
+}
+
+func (s *S) TestJsonUnmarshalResets(c *C) {
+	vc1 := vclock.New()
+	vc1.Update("idA", 1)
+	j1, _ := json.Marshal(vc1)
+	vc1.SetJSONFormat(vclock.JSONObject)
+	j2, _ := json.Marshal(vc1)
+
+	for _, j := range [][]byte{j1, j2} {
+		vc2 := vclock.New()
+		vc2.Update("idA", 1)
+		vc2.Update("idB", 1)
+		err := json.Unmarshal(j, vc2)
+		c.Assert(err, IsNil)
+		c.Assert(vc2.Compare(vc1, vclock.Equal), Equals, true)
+	}
+}
+
+func (s *S) TestJsonBadData(c *C) {
+	vc := vclock.New()
+	vc.Update("idA", 1)
+	for _, j := range []string{`"gA=="`, `{"idA":"x"}`, `{"idA":{"ticks":-1}}`, `true`} {
+		err := json.Unmarshal([]byte(j), vc)
+		c.Assert(err, NotNil, Commentf("%s", j))
+		c.Assert(vc.LastUpdate(), Equals, uint64(1))
+	}
+}
+
+type gobObject struct {
+	Key      string
+	Version  *vclock.VClock
+	Versions []vclock.VClock
+	Missing  *vclock.VClock
+}
+
+func (s *S) TestGob(c *C) {
+	vc1 := vclock.New()
+	vc1.Update("idA", 1)
+	vc1.Update("idB", 300)
+	vc2 := vclock.New()
+	vc2.Update("idC", 0)
+
+	var buf bytes.Buffer
+	obj1 := gobObject{"key", vc1, []vclock.VClock{*vc2, *vclock.New(), *vc1}, nil}
+	err := gob.NewEncoder(&buf).Encode(&obj1)
+	c.Assert(err, IsNil)
+
+	var obj2 gobObject
+	err = gob.NewDecoder(&buf).Decode(&obj2)
+	c.Assert(err, IsNil)
+	c.Assert(obj2.Key, Equals, "key")
+	c.Assert(obj2.Version.Bytes(), DeepEquals, vc1.Bytes())
+	c.Assert(obj2.Versions, HasLen, 3)
+	c.Assert(obj2.Versions[0].Bytes(), DeepEquals, vc2.Bytes())
+	c.Assert(obj2.Versions[1].Len(), Equals, 0)
+	c.Assert(obj2.Versions[2].Bytes(), DeepEquals, vc1.Bytes())
+	c.Assert(obj2.Missing, IsNil)
+}
+
+func (s *S) TestGobDecodeResets(c *C) {
+	vc1 := vclock.New()
+	vc1.Update("idA", 1)
+	vc2 := vclock.New()
+	vc2.Update("idB", 1)
+	data, err := vc1.GobEncode()
+	c.Assert(err, IsNil)
+	c.Assert(vc2.GobDecode(data), IsNil)
+	c.Assert(vc2.Compare(vc1, vclock.Equal), Equals, true)
+	c.Assert(vc2.GobDecode([]byte{128}), ErrorMatches, "bad vclock header")
+}
@@ -0,0 +1,132 @@
+// Package voldemort converts vector clocks to and from the serialized
+// form of Voldemort's VectorClock.
+//
+// A Voldemort vector clock holds a version counter per numeric node id,
+// and a single timestamp for the whole clock. Its serialized form is:
+//
+//	[ N (2 bytes) | version size (1 byte) | [ node id (2 bytes) | version ] * N | timestamp (8 bytes) ]
+//
+// with entries sorted by node id, every version taking version size bytes,
+// and all integers stored in big-endian order.
+package voldemort
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/jbondeson/vclock"
+	"sort"
+	"strconv"
+)
+
+// IDMap converts between vclock ids and Voldemort node ids.
+// Either function may be nil, in which case node ids are represented
+// as vclock ids holding their decimal form.
+type IDMap struct {
+	NodeID func(id string) (int16, error)
+	ID     func(node int16) (string, error)
+}
+
+func (m *IDMap) nodeID(id string) (int16, error) {
+	if m != nil && m.NodeID != nil {
+		return m.NodeID(id)
+	}
+	node, err := strconv.ParseInt(id, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("vclock id %q is not a voldemort node id", id)
+	}
+	return int16(node), nil
+}
+
+func (m *IDMap) id(node int16) (string, error) {
+	if m != nil && m.ID != nil {
+		return m.ID(node)
+	}
+	return strconv.Itoa(int(node)), nil
+}
+
+var errBadClock = errors.New("bad voldemort vclock")
+
+// Marshal returns the Voldemort serialized form of vc, with ids converted
+// to node ids by m, which may be nil. Voldemort keeps a single timestamp
+// per clock, which is set to vc.LastUpdate.
+func Marshal(vc *vclock.VClock, m *IDMap) ([]byte, error) {
+	type nodeEntry struct {
+		node    int16
+		version uint64
+	}
+	entries := vc.Entries()
+	if len(entries) > 0x7fff {
+		return nil, errors.New("too many entries for a voldemort vclock")
+	}
+	nodes := make([]nodeEntry, len(entries))
+	var maxVersion uint64
+	for i, e := range entries {
+		node, err := m.nodeID(e.ID)
+		if err != nil {
+			return nil, err
+		}
+		nodes[i] = nodeEntry{node, e.Ticks}
+		if e.Ticks > maxVersion {
+			maxVersion = e.Ticks
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].node < nodes[j].node })
+	for i := 1; i < len(nodes); i++ {
+		if nodes[i].node == nodes[i-1].node {
+			return nil, fmt.Errorf("duplicate voldemort node id %d", nodes[i].node)
+		}
+	}
+
+	versionSize := 1
+	for v := maxVersion >> 8; v > 0; v >>= 8 {
+		versionSize++
+	}
+	out := make([]byte, 0, 3+len(nodes)*(2+versionSize)+8)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(nodes)))
+	out = append(out, byte(versionSize))
+	for _, n := range nodes {
+		out = binary.BigEndian.AppendUint16(out, uint16(n.node))
+		for shift := 8 * (versionSize - 1); shift >= 0; shift -= 8 {
+			out = append(out, byte(n.version>>uint(shift)))
+		}
+	}
+	return binary.BigEndian.AppendUint64(out, vc.LastUpdate()), nil
+}
+
+// Unmarshal returns the vector clock represented by the Voldemort
+// serialized form in data, with node ids converted to vclock ids by m,
+// which may be nil. The clock timestamp is used as the update time of
+// every entry.
+func Unmarshal(data []byte, m *IDMap) (*vclock.VClock, error) {
+	if len(data) < 3 {
+		return nil, errBadClock
+	}
+	n := int(binary.BigEndian.Uint16(data))
+	versionSize := int(data[2])
+	if n > 0x7fff || versionSize < 1 || versionSize > 8 || len(data) != 3+n*(2+versionSize)+8 {
+		return nil, errBadClock
+	}
+	timestamp := binary.BigEndian.Uint64(data[len(data)-8:])
+	data = data[3:]
+	entries := make([]vclock.Entry, n)
+	seen := make(map[int16]bool, n)
+	for i := range entries {
+		node := int16(binary.BigEndian.Uint16(data))
+		if seen[node] {
+			return nil, errBadClock
+		}
+		seen[node] = true
+		var version uint64
+		for _, b := range data[2 : 2+versionSize] {
+			version = version<<8 | uint64(b)
+		}
+		data = data[2+versionSize:]
+		id, err := m.id(node)
+		if err != nil {
+			return nil, err
+		}
+		entries[i] = vclock.Entry{ID: id, Ticks: version, LastUpdate: timestamp}
+	}
+	return vclock.FromEntries(entries), nil
+}
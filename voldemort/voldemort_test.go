@@ -0,0 +1,110 @@
+package voldemort_test
+
+import (
+	"errors"
+	"github.com/jbondeson/vclock"
+	"github.com/jbondeson/vclock/voldemort"
+	. "launchpad.net/gocheck"
+	"strings"
+	"testing"
+)
+
+func TestAll(c *testing.T) {
+	TestingT(c)
+}
+
+type S struct{}
+
+var _ = Suite(&S{})
+
+func (S) TestMarshal(c *C) {
+	vc := vclock.FromEntries([]vclock.Entry{
+		{ID: "3", Ticks: 300, LastUpdate: 1369000000000},
+		{ID: "1", Ticks: 2, LastUpdate: 1368000000000},
+	})
+	data, err := voldemort.Marshal(vc, nil)
+	c.Assert(err, IsNil)
+	c.Assert(data, DeepEquals, []byte{
+		0, 2, // Entries.
+		2,          // Version size.
+		0, 1, 0, 2, // Node 1, version 2.
+		0, 3, 1, 44, // Node 3, version 300.
+		0, 0, 1, 62, 190, 194, 58, 0, // Timestamp.
+	})
+
+	decoded, err := voldemort.Unmarshal(data, nil)
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Entries(), DeepEquals, []vclock.Entry{
+		{ID: "1", Ticks: 2, LastUpdate: 1369000000000},
+		{ID: "3", Ticks: 300, LastUpdate: 1369000000000},
+	})
+}
+
+func (S) TestEmpty(c *C) {
+	data, err := voldemort.Marshal(vclock.New(), nil)
+	c.Assert(err, IsNil)
+	c.Assert(data, DeepEquals, []byte{0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0})
+	decoded, err := voldemort.Unmarshal(data, nil)
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Len(), Equals, 0)
+}
+
+func (S) TestIDMap(c *C) {
+	m := &voldemort.IDMap{
+		NodeID: func(id string) (int16, error) {
+			switch id {
+			case "alpha":
+				return 7, nil
+			case "beta":
+				return 8, nil
+			}
+			return 0, errors.New("unknown node " + id)
+		},
+		ID: func(node int16) (string, error) {
+			return [...]string{7: "alpha", 8: "beta"}[node], nil
+		},
+	}
+	vc := vclock.New()
+	vc.Update("beta", 0)
+	vc.Update("alpha", 0)
+	data, err := voldemort.Marshal(vc, m)
+	c.Assert(err, IsNil)
+	c.Assert(data[3:9], DeepEquals, []byte{0, 7, 1, 0, 8, 1})
+
+	decoded, err := voldemort.Unmarshal(data, m)
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Compare(vc, vclock.Equal), Equals, true)
+
+	vc.Update("gamma", 0)
+	_, err = voldemort.Marshal(vc, m)
+	c.Assert(err, ErrorMatches, "unknown node gamma")
+}
+
+func (S) TestMarshalWithBadIDs(c *C) {
+	vc := vclock.New()
+	vc.Update("idA", 0)
+	_, err := voldemort.Marshal(vc, nil)
+	c.Assert(err, ErrorMatches, `vclock id "idA" is not a voldemort node id`)
+
+	vc = vclock.New()
+	vc.Update("1", 0)
+	vc.Update("01", 0)
+	_, err = voldemort.Marshal(vc, nil)
+	c.Assert(err, ErrorMatches, "duplicate voldemort node id 1")
+}
+
+func (S) TestUnmarshalWithBadData(c *C) {
+	for _, data := range [][]byte{
+		{},
+		{0, 0},
+		{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+		{0, 0, 9, 0, 0, 0, 0, 0, 0, 0, 0},
+		{0, 1, 1, 0, 1, 1, 0, 0, 0, 0, 0, 0, 0},
+		{0, 2, 1, 0, 1, 1, 0, 1, 1, 0, 0, 0, 0, 0, 0, 0, 0},
+		append([]byte{0x80, 0, 1}, strings.Repeat("\x00", 11)...),
+	} {
+		vc, err := voldemort.Unmarshal(data, nil)
+		c.Assert(err, ErrorMatches, "bad voldemort vclock", Commentf("%v", data))
+		c.Assert(vc, IsNil)
+	}
+}